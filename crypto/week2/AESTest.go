@@ -1,109 +1,364 @@
+// Command week2 encrypts or decrypts a file or stdin with the week2 modes
+// and writes the result to a file or stdout, so it can sit in a pipeline:
+//
+//	week2 -mode ctr -key 36f18357be4dbd77f050515c73fcf9f2 -encoding hex < msg
+//	week2 -d -mode ctr -key-file key.hex -encoding hex -i msg.hex
+//
+// Encrypted output is a container (see package container) that records
+// the cipher, mode and IV, so decryption needs only the key; -format bare
+// writes just the IV or nonce and the ciphertext. With -pass-file or
+// -pass-env the keys are derived from a passphrase instead, with -kdf and
+// -kdf-iter or the -scrypt costs, and the container also records the KDF,
+// salt and costs and ends with an HMAC:
+//
+//	week2 -mode ctr -pass-file ~/.week2pass -i report.pdf -o report.enc
+//	week2 -d -pass-file ~/.week2pass -i report.enc -o report.pdf
+//
+// -format openssl reads and writes the Salted__ files of openssl enc, with
+// its -md, -pbkdf2 and -iter flags:
+//
+//	week2 -format openssl -openssl-cipher aes-128-cbc -pbkdf2 -pass-file pw < msg
+//	openssl enc -d -aes-128-cbc -pbkdf2 -pass file:pw
+//
+// The exit code is 0 on success, 1 if encryption, decryption or I/O failed
+// and 2 for bad flags.
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
-	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+
+	"github.com/lumieru/coursera/crypto/week2/chacha20"
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+const (
+	exitFailure = 1
+	exitUsage   = 2
 )
 
 const (
 	TYPE_CBC int = iota
 	TYPE_CTR
+	// TYPE_CHACHA20 takes a 32 byte key and the first 12 bytes of the IV
+	// as nonce.
+	TYPE_CHACHA20
+	// TYPE_CHACHA20_POLY1305 and TYPE_XCHACHA20_POLY1305 output
+	// nonce||ciphertext||tag, without associated data.
+	TYPE_CHACHA20_POLY1305
+	TYPE_XCHACHA20_POLY1305
+	// TYPE_ECB and the ones after it are only for data from legacy
+	// systems.
+	TYPE_ECB
+	TYPE_CFB
+	TYPE_CFB8
+	TYPE_OFB
+	TYPE_PCBC
+)
+
+// modeNames maps the -mode names to the mode types.
+var modeNames = map[string]int{
+	"cbc":                TYPE_CBC,
+	"ctr":                TYPE_CTR,
+	"chacha20":           TYPE_CHACHA20,
+	"chacha20-poly1305":  TYPE_CHACHA20_POLY1305,
+	"xchacha20-poly1305": TYPE_XCHACHA20_POLY1305,
+	"ecb":                TYPE_ECB,
+	"cfb":                TYPE_CFB,
+	"cfb8":               TYPE_CFB8,
+	"ofb":                TYPE_OFB,
+	"pcbc":               TYPE_PCBC,
+}
+
+var (
+	decryptFlag     = flag.Bool("d", false, "Decrypt instead of encrypt.")
+	modeFlag        = flag.String("mode", "cbc", "Mode: cbc, ctr, chacha20, chacha20-poly1305, xchacha20-poly1305, or for legacy data ecb, cfb, cfb8, ofb or pcbc.")
+	keyFlag         = flag.String("key", "", "Key in -key-encoding; 16, 24 or 32 bytes for AES, 32 for ChaCha20.")
+	keyFileFlag     = flag.String("key-file", "", "Read the key from this file instead of -key.")
+	keyEncodingFlag = flag.String("key-encoding", "hex", "Encoding of the key: raw, hex or base64.")
+	inputFlag       = flag.String("i", "-", "Input file name, - for stdin.")
+	outputFlag      = flag.String("o", "-", "Output file name, - for stdout.")
+	encodingFlag    = flag.String("encoding", "raw", "Encoding of the ciphertext, the output when encrypting and the input when decrypting: raw, hex or base64.")
 )
 
-type AESData struct {
-	message    []byte
-	ciphertext []byte
-	key        []byte
-	mode       int
+// newModeCipher returns AES for the modes built on a block cipher, and
+// nil for the ChaCha20 ones, which use the key itself.
+func newModeCipher(mode int, key []byte) (cipher.Block, error) {
+	switch mode {
+	case TYPE_CHACHA20, TYPE_CHACHA20_POLY1305, TYPE_XCHACHA20_POLY1305:
+		return nil, nil
+	}
+
+	return aes.NewCipher(key)
 }
 
-var datas = [...]AESData{
-	{[]byte("Basic CBC mode encryption needs padding."), []byte("4ca00ff4c898d61e1edbf1800618fb2828a226d160dad07883d04e008a7897ee2e4b7465d5290d0c0e6c6822236e1daafb94ffe0c5da05d9476be028ad7c1d81"), []byte("140b41b22a29beb4061bda66b6747e14"), TYPE_CBC},
-	{[]byte("Our implementation uses rand. IV"), []byte("5b68629feb8606f9a6667670b75b38a5b4832d0f26e1ab7da33249de7d4afc48e713ac646ace36e872ad5fb8a512428a6e21364b0c374df45503473c5242a253"), []byte("140b41b22a29beb4061bda66b6747e14"), TYPE_CBC},
-	{[]byte("CTR mode lets you build a stream cipher from a block cipher."), []byte("69dda8455c7dd4254bf353b773304eec0ec7702330098ce7f7520d1cbbb20fc388d1b0adb5054dbd7370849dbf0b88d393f252e764f1f5f7ad97ef79d59ce29f5f51eeca32eabedd9afa9329"), []byte("36f18357be4dbd77f050515c73fcf9f2"), TYPE_CTR},
-	{[]byte("Always avoid the two time pad!"), []byte("770b80259ec33beb2561358a9f2dc617e46218c0a53cbeca695ae45faa8952aa0e311bde9d4e01726d3184c34451"), []byte("36f18357be4dbd77f050515c73fcf9f2"), TYPE_CTR},
+// newModeAEAD returns the AEAD of an AEAD mode.
+func newModeAEAD(mode int, key []byte) (cipher.AEAD, error) {
+	if mode == TYPE_XCHACHA20_POLY1305 {
+		return chacha20.NewXAEAD(key)
+	}
+
+	return chacha20.NewAEAD(key)
 }
 
-func Encrypt() {
-	iv := make([]byte, 16)
-	for i := 0; i < len(datas); i++ {
-		binKey := make([]byte, hex.DecodedLen(len(datas[i].key)))
-		_, err := hex.Decode(binKey, datas[i].key)
-		if err != nil {
-			log.Printf("Decode hex key failed:%s\n", err.Error())
-			return
+// sealMode seals msg with a nonce made of iv, filled up with random bytes
+// where iv is too short, and returns nonce||ciphertext||tag.
+func sealMode(mode int, key, iv, msg []byte) ([]byte, error) {
+	aead, err := newModeAEAD(mode, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if n := copy(nonce, iv); n < len(nonce) {
+		if _, err := rand.Read(nonce[n:]); err != nil {
+			return nil, err
 		}
-		aesCiper, err := aes.NewCipher(binKey)
+	}
+
+	return aead.Seal(nonce, nonce, msg, nil), nil
+}
+
+// openMode opens what sealMode returns.
+func openMode(mode int, key, src []byte) ([]byte, error) {
+	aead, err := newModeAEAD(mode, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(src) < aead.NonceSize() {
+		return nil, errors.New("ciphertext shorter than the nonce")
+	}
+
+	return aead.Open(nil, src[:aead.NonceSize()], src[aead.NonceSize():], nil)
+}
+
+// encryptMode encrypts msg in the given mode and returns iv||ciphertext,
+// or just the ciphertext for ECB.
+func encryptMode(mode int, key, iv, msg []byte) ([]byte, error) {
+	b, err := newModeCipher(mode, key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case TYPE_CBC:
+		enc := modes.NewMyCBCEncrypter(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	case TYPE_CTR:
+		enc := modes.NewMyCTR(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg)
+	case TYPE_CHACHA20:
+		enc, err := chacha20.New(key, iv[:chacha20.NonceSize])
 		if err != nil {
-			log.Printf("Create aes cipher failed:%s\n", err.Error())
-			return
+			return nil, err
 		}
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg)
+	case TYPE_CHACHA20_POLY1305, TYPE_XCHACHA20_POLY1305:
+		return sealMode(mode, key, iv, msg)
+	case TYPE_ECB:
+		enc := modes.NewMyInsecureECBEncrypter(b)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	case TYPE_CFB:
+		enc := modes.NewMyCFBEncrypter(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	case TYPE_CFB8:
+		enc := modes.NewMyCFB8Encrypter(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	case TYPE_OFB:
+		enc := modes.NewMyOFB(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	case TYPE_PCBC:
+		enc := modes.NewMyPCBCEncrypter(b, iv)
+		return enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg), nil
+	}
+
+	return nil, fmt.Errorf("unknown mode %d", mode)
+}
+
+// decryptMode decrypts what encryptMode returns. The IV is read from src,
+// iv only has to be one block long.
+func decryptMode(mode int, key, iv, src []byte) ([]byte, error) {
+	b, err := newModeCipher(mode, key)
+	if err != nil {
+		return nil, err
+	}
 
-		_, err = rand.Read(iv)
+	dst := make([]byte, len(src))
+	switch mode {
+	case TYPE_CBC:
+		return modes.NewMyCBCDecrypter(b, iv).Decrypt(dst, src)
+	case TYPE_CTR:
+		return modes.NewMyCTR(b, iv).Decrypt(dst, src)
+	case TYPE_CHACHA20:
+		dec, err := chacha20.New(key, iv[:chacha20.NonceSize])
 		if err != nil {
-			log.Printf("Create iv failed:%s\n", err.Error())
-			return
+			return nil, err
 		}
+		return dec.Decrypt(dst, src)
+	case TYPE_CHACHA20_POLY1305, TYPE_XCHACHA20_POLY1305:
+		return openMode(mode, key, src)
+	case TYPE_ECB:
+		return modes.NewMyInsecureECBDecrypter(b).Decrypt(dst, src)
+	case TYPE_CFB:
+		return modes.NewMyCFBDecrypter(b, iv).Decrypt(dst, src)
+	case TYPE_CFB8:
+		return modes.NewMyCFB8Decrypter(b, iv).Decrypt(dst, src)
+	case TYPE_OFB:
+		return modes.NewMyOFB(b, iv).Decrypt(dst, src)
+	case TYPE_PCBC:
+		return modes.NewMyPCBCDecrypter(b, iv).Decrypt(dst, src)
+	}
 
-		var dst []byte
-		if datas[i].mode == TYPE_CBC {
-			enc := NewMyCBCEncrypter(aesCiper, iv)
-			dst = make([]byte, enc.EncryptedSize(len(datas[i].message)))
-			enc.CryptBlocks(&dst, datas[i].message)
-		} else {
-			enc := NewMyCTR(aesCiper, iv)
-			dst = make([]byte, enc.EncryptedSize(len(datas[i].message)))
-			enc.XORKeyStream(&dst, datas[i].message, true)
-		}
+	return nil, fmt.Errorf("unknown mode %d", mode)
+}
+
+func readKey() ([]byte, error) {
+	if (*keyFlag == "") == (*keyFileFlag == "") {
+		return nil, errors.New("need one of -key and -key-file")
+	}
 
-		log.Printf("src: %s => Dst:%x\n", datas[i].message, dst)
+	data := []byte(*keyFlag)
+	if *keyFileFlag != "" {
+		var err error
+		data, err = ioutil.ReadFile(*keyFileFlag)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	return ioutil.ReadAll(newDecoder(bytes.NewReader(data), *keyEncodingFlag))
 }
 
-func Decrypt() {
-	iv := make([]byte, 16)
-	for i := 0; i < len(datas); i++ {
-		binKey := make([]byte, hex.DecodedLen(len(datas[i].key)))
-		_, err := hex.Decode(binKey, datas[i].key)
+// run does the work of main and returns the exit code. Bare CBC and CTR
+// and the chunked AEAD containers are piped from -i to -o; openssl files
+// and the other modes are read into memory, as they are done as a whole.
+// A failed run removes the output file, so a decryption that fails half
+// way leaves no plaintext behind.
+func run() int {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		log.Printf("Unexpected arguments %q\n", flag.Args())
+		flag.Usage()
+		return exitUsage
+	}
+
+	mode, ok := modeNames[*modeFlag]
+	if !ok {
+		log.Printf("Unknown -mode %s\n", *modeFlag)
+		return exitUsage
+	}
+	if *formatFlag != "container" && *formatFlag != "bare" && *formatFlag != "openssl" {
+		log.Printf("Unknown -format %s\n", *formatFlag)
+		return exitUsage
+	}
+	if *iterFlag != 0 && *formatFlag != "openssl" {
+		log.Printf("-iter is for -format openssl, containers take -kdf-iter\n")
+		return exitUsage
+	}
+	for _, encoding := range []string{*encodingFlag, *keyEncodingFlag} {
+		if !knownEncoding(encoding) {
+			log.Printf("Unknown encoding %s\n", encoding)
+			return exitUsage
+		}
+	}
+
+	var key, passphrase []byte
+	var params *kdf.Params
+	var err error
+	if passphraseMode() {
+		passphrase, err = readPassphrase()
 		if err != nil {
-			log.Printf("Decode hex key failed:%s\n", err.Error())
-			return
+			log.Printf("Read passphrase failed:%s\n", err.Error())
+			return exitUsage
+		}
+		if *formatFlag == "bare" {
+			log.Printf("A passphrase needs -format container or openssl\n")
+			return exitUsage
 		}
-		aesCiper, err := aes.NewCipher(binKey)
+		if *formatFlag == "openssl" {
+			if _, err := opensslKDF(); err != nil {
+				log.Printf("Bad openssl flags:%s\n", err.Error())
+				return exitUsage
+			}
+		}
+		if *formatFlag == "container" && !*decryptFlag {
+			params, err = newKDFParams()
+			if err != nil {
+				log.Printf("Bad KDF flags:%s\n", err.Error())
+				return exitUsage
+			}
+		}
+	} else if *formatFlag == "openssl" {
+		log.Printf("-format openssl needs -pass-file or -pass-env\n")
+		return exitUsage
+	} else {
+		key, err = readKey()
 		if err != nil {
-			log.Printf("Create aes cipher failed:%s\n", err.Error())
-			return
+			log.Printf("Read key failed:%s\n", err.Error())
+			return exitUsage
 		}
+	}
+
+	in, err := openInput(*inputFlag)
+	if err != nil {
+		log.Printf("Open input failed:%s\n", err.Error())
+		return exitFailure
+	}
+	defer in.Close()
+	out, err := createOutput(*outputFlag, in)
+	if err != nil {
+		log.Printf("Create output failed:%s\n", err.Error())
+		return exitFailure
+	}
+	bw := bufio.NewWriter(out)
 
-		_, err = rand.Read(iv)
+	if *decryptFlag {
+		err = decrypt(mode, key, passphrase, newDecoder(in, *encodingFlag), bw)
 		if err != nil {
-			log.Printf("Create iv failed:%s\n", err.Error())
-			return
+			log.Printf("Decrypt failed:%s\n", err.Error())
+		}
+	} else {
+		enc := newEncoder(bw, *encodingFlag)
+		err = encrypt(mode, key, passphrase, params, in, enc)
+		if err == nil {
+			err = enc.Close()
 		}
-
-		binBuffer := make([]byte, hex.DecodedLen(len(datas[i].ciphertext)))
-		_, err = hex.Decode(binBuffer, datas[i].ciphertext)
 		if err != nil {
-			log.Printf("Decode hex failed:%s\n", err.Error())
-			return
+			log.Printf("Encrypt failed:%s\n", err.Error())
 		}
-		dst := make([]byte, len(binBuffer))
-
-		if datas[i].mode == TYPE_CBC {
-			enc := NewMyCBCDecrypter(aesCiper, iv)
-			enc.CryptBlocks(&dst, binBuffer)
-		} else {
-			enc := NewMyCTR(aesCiper, iv)
-			enc.XORKeyStream(&dst, binBuffer, false)
+	}
+	if err == nil {
+		if err = bw.Flush(); err != nil {
+			log.Printf("Write output failed:%s\n", err.Error())
 		}
+	}
 
-		log.Printf("src: %s => Dst:%s\n", datas[i].message, dst)
+	if out != os.Stdout {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			log.Printf("Write output failed:%s\n", cerr.Error())
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out.Name())
+		}
 	}
+	if err != nil {
+		return exitFailure
+	}
+
+	return 0
 }
 
 func main() {
-	//Encrypt()
-	Decrypt()
+	os.Exit(run())
 }
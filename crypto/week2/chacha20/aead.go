@@ -0,0 +1,132 @@
+package chacha20
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/sliceutil"
+	"github.com/lumieru/coursera/crypto/week2/poly1305"
+)
+
+// maxPlaintext is how much the AEAD encrypts under one nonce: block 0 of
+// the key stream makes the Poly1305 key, the other 2^32-1 encrypt.
+const maxPlaintext = (maxBlocks - 1) * blockSize
+
+var errOpen = errors.New("chacha20: message authentication failed")
+
+// chachaPoly is the ChaCha20-Poly1305 AEAD of RFC 8439 section 2.8, with
+// XChaCha20 instead of ChaCha20 when nonceSize is NonceSizeX.
+type chachaPoly struct {
+	key       []byte
+	nonceSize int
+}
+
+// NewAEAD returns ChaCha20-Poly1305 with a 32-byte key. It takes a 12-byte
+// nonce, which must never repeat under the same key.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	return newAEAD(key, NonceSize)
+}
+
+// NewXAEAD returns XChaCha20-Poly1305 with a 32-byte key. It takes a
+// 24-byte nonce, which may be picked at random.
+func NewXAEAD(key []byte) (cipher.AEAD, error) {
+	return newAEAD(key, NonceSizeX)
+}
+
+func newAEAD(key []byte, nonceSize int) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+
+	return &chachaPoly{
+		key:       append([]byte(nil), key...),
+		nonceSize: nonceSize,
+	}, nil
+}
+
+func (c *chachaPoly) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *chachaPoly) Overhead() int {
+	return poly1305.TagSize
+}
+
+func (c *chachaPoly) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("chacha20: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	if uint64(len(plaintext)) > maxPlaintext {
+		panic("chacha20: message too large for ChaCha20-Poly1305")
+	}
+
+	ret, out := sliceutil.ForAppend(dst, len(plaintext)+poly1305.TagSize)
+
+	s, mac := c.streamAndMAC(nonce)
+	s.XORKeyStream(out, plaintext)
+
+	ciphertext := out[:len(plaintext)]
+	writeMACData(mac, ciphertext, additionalData)
+	copy(out[len(plaintext):], mac.Sum(nil))
+
+	return ret
+}
+
+func (c *chachaPoly) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		panic("chacha20: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	if len(ciphertext) < poly1305.TagSize {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > maxPlaintext+poly1305.TagSize {
+		return nil, errOpen
+	}
+
+	tagged := len(ciphertext) - poly1305.TagSize
+	s, mac := c.streamAndMAC(nonce)
+	writeMACData(mac, ciphertext[:tagged], additionalData)
+	if !mac.Verify(ciphertext[tagged:]) {
+		return nil, errOpen
+	}
+
+	ret, out := sliceutil.ForAppend(dst, tagged)
+	s.XORKeyStream(out, ciphertext[:tagged])
+
+	return ret, nil
+}
+
+// streamAndMAC returns the key stream for nonce at block 1 and the
+// Poly1305 keyed with the first 32 bytes of block 0.
+func (c *chachaPoly) streamAndMAC(nonce []byte) (*Cipher, *poly1305.MAC) {
+	s, err := newCipher(c.key, nonce)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	var polyKey [blockSize]byte
+	s.XORKeyStream(polyKey[:], polyKey[:])
+	mac, err := poly1305.New(polyKey[:poly1305.KeySize])
+	if err != nil {
+		panic(err.Error())
+	}
+	s.SetCounter(1)
+
+	return s, mac
+}
+
+// writeMACData writes aad and ciphertext, each padded with zeros to 16
+// bytes, and their lengths as 64-bit little endian numbers.
+func writeMACData(mac *poly1305.MAC, ciphertext, additionalData []byte) {
+	var pad [16]byte
+	mac.Write(additionalData)
+	mac.Write(pad[:(16-len(additionalData)%16)%16])
+	mac.Write(ciphertext)
+	mac.Write(pad[:(16-len(ciphertext)%16)%16])
+
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+	mac.Write(lengths[:])
+}
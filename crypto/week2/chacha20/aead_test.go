@@ -0,0 +1,89 @@
+package chacha20_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/chacha20"
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+)
+
+var sunscreen = fmt.Sprintf("%x", "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+
+// chachaPolyVectors are RFC 8439 section 2.8.2 and section A.3.1 of
+// draft-irtf-cfrg-xchacha; the ciphertext ends with the tag.
+var chachaPolyVectors = []struct {
+	name       string
+	newAEAD    func([]byte) (cipher.AEAD, error)
+	key        string
+	nonce      string
+	ad         string
+	plaintext  string
+	ciphertext string
+}{
+	{
+		"ChaCha20-Poly1305 RFC 8439 2.8.2",
+		chacha20.NewAEAD,
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"50515253c0c1c2c3c4c5c6c7",
+		sunscreen,
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" +
+			"1ae10b594f09e26a7e902ecbd0600691",
+	},
+	{
+		"XChaCha20-Poly1305 draft A.3.1",
+		chacha20.NewXAEAD,
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"404142434445464748494a4b4c4d4e4f5051525354555657",
+		"50515253c0c1c2c3c4c5c6c7",
+		sunscreen,
+		"bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52e" +
+			"c0875924c1c7987947deafd8780acf49",
+	},
+}
+
+func TestChaChaPolyVectors(t *testing.T) {
+	for _, v := range chachaPolyVectors {
+		aead, err := v.newAEAD(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		nonce, ad := testutil.Unhex(v.nonce), testutil.Unhex(v.ad)
+		plaintext, want := testutil.Unhex(v.plaintext), testutil.Unhex(v.ciphertext)
+
+		got := aead.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: Seal got %x, want %x", v.name, got, want)
+		}
+		opened, err := aead.Open(nil, nonce, want, ad)
+		if err != nil {
+			t.Fatalf("%s: Open failed with: %v", v.name, err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("%s: Open got %x, want %x", v.name, opened, plaintext)
+		}
+
+		// in place, as cipher.AEAD allows
+		buf := append([]byte(nil), plaintext...)
+		if got := aead.Seal(buf[:0], nonce, buf, ad); !bytes.Equal(got, want) {
+			t.Fatalf("%s: Seal in place got %x", v.name, got)
+		}
+
+		for k := range want {
+			bad := append([]byte(nil), want...)
+			bad[k] ^= 0x01
+			if _, err := aead.Open(nil, nonce, bad, ad); err == nil {
+				t.Fatalf("%s: Open with byte %d changed succeeded", v.name, k)
+			}
+		}
+		if _, err := aead.Open(nil, nonce, want, ad[1:]); err == nil {
+			t.Fatalf("%s: Open with other associated data succeeded", v.name)
+		}
+		if _, err := aead.Open(nil, nonce, want[:aead.Overhead()-1], ad); err == nil {
+			t.Fatalf("%s: Open shorter than a tag succeeded", v.name)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Package chacha20 implements the ChaCha20 stream cipher of RFC 8439 and
+// its extended nonce variant XChaCha20, with the same XORKeyStream,
+// EncryptedSize and Encrypt/Decrypt conventions as modes.MyCTR: the wire
+// format is the nonce followed by the ciphertext. NewAEAD and NewXAEAD
+// add Poly1305 to make ChaCha20-Poly1305 and XChaCha20-Poly1305.
+package chacha20
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	// KeySize is the ChaCha20 key size.
+	KeySize = 32
+	// NonceSize is the RFC 8439 nonce size.
+	NonceSize = 12
+	// NonceSizeX is the XChaCha20 nonce size.
+	NonceSizeX = 24
+
+	blockSize = 64
+	// maxBlocks is the number of blocks of the 32-bit block counter.
+	maxBlocks = 1 << 32
+)
+
+var (
+	ErrKeySize   = errors.New("chacha20: key must be 32 bytes")
+	ErrNonceSize = errors.New("chacha20: wrong nonce size")
+	// ErrCounterOverflow is returned when the block counter would wrap
+	// around and repeat key stream, after 256 GiB.
+	ErrCounterOverflow = errors.New("chacha20: counter overflow")
+	// ErrShortCiphertext is returned by Decrypt for input shorter than a
+	// nonce.
+	ErrShortCiphertext = errors.New("chacha20: ciphertext shorter than the nonce")
+)
+
+// Cipher is a ChaCha20 or XChaCha20 key stream. It satisfies cipher.Stream.
+type Cipher struct {
+	key   [8]uint32
+	nonce []byte
+	// subkey and words are the key and nonce the blocks are made from,
+	// for XChaCha20 derived from key and nonce with HChaCha20.
+	subkey [8]uint32
+	words  [3]uint32
+	// next is the number of the next block, maxBlocks once the counter
+	// is used up; out is the current key stream block of which used
+	// bytes are already consumed.
+	next uint64
+	out  [blockSize]byte
+	used int
+}
+
+// New returns ChaCha20 with a 32-byte key and a 12-byte nonce, starting at
+// block 0.
+func New(key, nonce []byte) (*Cipher, error) {
+	if len(nonce) != NonceSize {
+		return nil, ErrNonceSize
+	}
+
+	return newCipher(key, nonce)
+}
+
+// NewX returns XChaCha20 with a 32-byte key and a 24-byte nonce, which is
+// long enough to be picked at random for every message.
+func NewX(key, nonce []byte) (*Cipher, error) {
+	if len(nonce) != NonceSizeX {
+		return nil, ErrNonceSize
+	}
+
+	return newCipher(key, nonce)
+}
+
+func newCipher(key, nonce []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+
+	c := &Cipher{nonce: append([]byte(nil), nonce...)}
+	for k := range c.key {
+		c.key[k] = binary.LittleEndian.Uint32(key[4*k:])
+	}
+	c.reset(nonce)
+
+	return c, nil
+}
+
+// NonceSize returns the size of the nonce the Cipher was created with.
+func (c *Cipher) NonceSize() int {
+	return len(c.nonce)
+}
+
+// EncryptedSize returns the length of Encrypt's output for srcLen bytes.
+func (c *Cipher) EncryptedSize(srcLen int) int {
+	// source len + nonce len
+	return srcLen + len(c.nonce)
+}
+
+// reset restarts the key stream at block 0 of nonce, which has the size
+// of the Cipher's nonce.
+func (c *Cipher) reset(nonce []byte) {
+	c.subkey = c.key
+	if len(nonce) == NonceSizeX {
+		c.subkey = hChaCha20(&c.key, nonce[:16])
+		nonce = append(make([]byte, 4), nonce[16:]...)
+	}
+	for k := range c.words {
+		c.words[k] = binary.LittleEndian.Uint32(nonce[4*k:])
+	}
+
+	c.next = 0
+	c.used = blockSize
+}
+
+// XORKeyStream XORs each byte in the given slice with a byte from the
+// cipher's key stream. Dst and src may point to the same memory. It
+// panics, before touching dst, if src needs more key stream than is left
+// before the block counter wraps; use CheckLength to find out beforehand.
+func (c *Cipher) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+	if err := c.CheckLength(len(src)); err != nil {
+		panic(err.Error())
+	}
+
+	for len(src) > 0 {
+		if c.used == blockSize {
+			block(&c.out, &c.subkey, uint32(c.next), &c.words)
+			c.next++
+			c.used = 0
+		}
+
+		n := blockSize - c.used
+		if n > len(src) {
+			n = len(src)
+		}
+		for k := 0; k < n; k++ {
+			dst[k] = src[k] ^ c.out[c.used+k]
+		}
+		c.used += n
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// CheckLength returns ErrCounterOverflow if XORKeyStream can't process n
+// more bytes without the block counter wrapping around.
+func (c *Cipher) CheckLength(n int) error {
+	buffered := blockSize - c.used
+	if n <= buffered {
+		return nil
+	}
+
+	blocks := (uint64(n-buffered) + blockSize - 1) / blockSize
+	if blocks > maxBlocks-c.next {
+		return ErrCounterOverflow
+	}
+
+	return nil
+}
+
+// position returns the byte offset of the next key stream byte.
+func (c *Cipher) position() int64 {
+	return int64(c.next)*blockSize - int64(blockSize-c.used)
+}
+
+// SetCounter moves the key stream to the start of the given block, as the
+// initial counter of RFC 8439 does.
+func (c *Cipher) SetCounter(counter uint32) {
+	c.next = uint64(counter)
+	c.used = blockSize
+}
+
+// Seek moves the key stream to a byte offset from block 0. whence is
+// io.SeekStart or io.SeekCurrent; offsets past the 256 GiB of key stream
+// are rejected.
+func (c *Cipher) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.position()
+	default:
+		return c.position(), errors.New("chacha20: invalid whence")
+	}
+	if offset < 0 {
+		return c.position(), errors.New("chacha20: negative offset")
+	}
+	if uint64(offset) > maxBlocks*blockSize {
+		return c.position(), ErrCounterOverflow
+	}
+
+	c.next = uint64(offset / blockSize)
+	c.used = blockSize
+	if skip := int(offset % blockSize); skip > 0 {
+		block(&c.out, &c.subkey, uint32(c.next), &c.words)
+		c.next++
+		c.used = skip
+	}
+
+	return offset, nil
+}
+
+// Encrypt encrypts src from block 0 of the nonce the Cipher was created
+// with and writes nonce||ciphertext to dst, returning the written part of
+// dst. len(dst) must be at least EncryptedSize(len(src)). The nonce must
+// not be used for more than one message.
+func (c *Cipher) Encrypt(dst, src []byte) ([]byte, error) {
+	n := c.EncryptedSize(len(src))
+	if len(dst) < n {
+		panic("len(dst) < c.EncryptedSize(len(src))")
+	}
+
+	c.reset(c.nonce)
+	if err := c.CheckLength(len(src)); err != nil {
+		return nil, err
+	}
+
+	copy(dst, c.nonce)
+	c.XORKeyStream(dst[len(c.nonce):n], src)
+
+	return dst[:n], nil
+}
+
+// Decrypt decrypts nonce||ciphertext as written by Encrypt, taking the
+// nonce from the start of src. len(dst) must be at least
+// len(src) - NonceSize().
+func (c *Cipher) Decrypt(dst, src []byte) ([]byte, error) {
+	nonceSize := len(c.nonce)
+	if len(src) < nonceSize {
+		return nil, ErrShortCiphertext
+	}
+
+	n := len(src) - nonceSize
+	if len(dst) < n {
+		panic("len(dst) < len(src) - nonce size")
+	}
+
+	c.reset(src[:nonceSize])
+	if err := c.CheckLength(n); err != nil {
+		return nil, err
+	}
+	c.XORKeyStream(dst[:n], src[nonceSize:])
+
+	return dst[:n], nil
+}
+
+// The first four words of the state, "expand 32-byte k".
+const (
+	sigma0 = 0x61707865
+	sigma1 = 0x3320646e
+	sigma2 = 0x79622d32
+	sigma3 = 0x6b206574
+)
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d = bits.RotateLeft32(d^a, 16)
+	c += d
+	b = bits.RotateLeft32(b^c, 12)
+	a += b
+	d = bits.RotateLeft32(d^a, 8)
+	c += d
+	b = bits.RotateLeft32(b^c, 7)
+
+	return a, b, c, d
+}
+
+// rounds runs the 20 rounds, column and diagonal rounds in turn, on s.
+func rounds(s *[16]uint32) {
+	for i := 0; i < 10; i++ {
+		s[0], s[4], s[8], s[12] = quarterRound(s[0], s[4], s[8], s[12])
+		s[1], s[5], s[9], s[13] = quarterRound(s[1], s[5], s[9], s[13])
+		s[2], s[6], s[10], s[14] = quarterRound(s[2], s[6], s[10], s[14])
+		s[3], s[7], s[11], s[15] = quarterRound(s[3], s[7], s[11], s[15])
+
+		s[0], s[5], s[10], s[15] = quarterRound(s[0], s[5], s[10], s[15])
+		s[1], s[6], s[11], s[12] = quarterRound(s[1], s[6], s[11], s[12])
+		s[2], s[7], s[8], s[13] = quarterRound(s[2], s[7], s[8], s[13])
+		s[3], s[4], s[9], s[14] = quarterRound(s[3], s[4], s[9], s[14])
+	}
+}
+
+func initState(key *[8]uint32) [16]uint32 {
+	return [16]uint32{
+		sigma0, sigma1, sigma2, sigma3,
+		key[0], key[1], key[2], key[3], key[4], key[5], key[6], key[7],
+	}
+}
+
+// block is the ChaCha20 block function of RFC 8439 section 2.3.
+func block(out *[blockSize]byte, key *[8]uint32, counter uint32, nonce *[3]uint32) {
+	s := initState(key)
+	s[12], s[13], s[14], s[15] = counter, nonce[0], nonce[1], nonce[2]
+
+	x := s
+	rounds(&x)
+	for k := range x {
+		binary.LittleEndian.PutUint32(out[4*k:], x[k]+s[k])
+	}
+}
+
+// hChaCha20 derives the XChaCha20 subkey from the key and the first 16
+// bytes of the nonce: the ChaCha20 rounds without the final addition,
+// keeping the first and last row.
+func hChaCha20(key *[8]uint32, nonce []byte) [8]uint32 {
+	s := initState(key)
+	for k := 0; k < 4; k++ {
+		s[12+k] = binary.LittleEndian.Uint32(nonce[4*k:])
+	}
+
+	rounds(&s)
+
+	var subkey [8]uint32
+	copy(subkey[:4], s[:4])
+	copy(subkey[4:], s[12:])
+	return subkey
+}
+
+// HChaCha20 returns the 32-byte subkey HChaCha20 derives from a 32-byte
+// key and a 16-byte nonce.
+func HChaCha20(key, nonce []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	if len(nonce) != 16 {
+		return nil, ErrNonceSize
+	}
+
+	var k [8]uint32
+	for i := range k {
+		k[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	subkey := hChaCha20(&k, nonce)
+
+	out := make([]byte, KeySize)
+	for i, w := range subkey {
+		binary.LittleEndian.PutUint32(out[4*i:], w)
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package chacha20_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/chacha20"
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+)
+
+// chachaVectors are RFC 8439 sections 2.3.2 (the block function, as the
+// key stream), 2.4.2 and A.1 #1, and an XChaCha20 vector made with the
+// subkey from HChaCha20 and the cryptography package's ChaCha20.
+var chachaVectors = []struct {
+	name       string
+	key        string
+	nonce      string
+	counter    uint32
+	plaintext  string
+	ciphertext string
+}{
+	{
+		"RFC 8439 A.1 #1",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"000000000000000000000000",
+		0,
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"76b8e0ada0f13d90405d6ae55386bd28bdd219b8a08ded1aa836efcc8b770dc7da41597c5157488d7724e03fb8d84a376a43b8f41518a11cc387b669b2ee6586",
+	},
+	{
+		"RFC 8439 2.3.2",
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"000000090000004a00000000",
+		1,
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e",
+	},
+	{
+		"RFC 8439 2.4.2",
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"000000000000004a00000000",
+		1,
+		fmt.Sprintf("%x", "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."),
+		"6e2e359a2568f98041ba0728dd0d6981e97e7aec1d4360c20a27afccfd9fae0bf91b65c5524733ab8f593dabcd62b3571639d624e65152ab8f530c359f0861d807ca0dbf500d6a6156a38e088a22b65e52bc514d16ccf806818ce91ab77937365af90bbf74a35be6b40b8eedf2785e42874d",
+	},
+	{
+		"XChaCha20",
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"404142434445464748494a4b4c4d4e4f5051525354555657",
+		0,
+		fmt.Sprintf("%x", "The dhole (pronounced \"dole\") is also known as the Asiatic wild dog, red dog, and whistling dog."),
+		"2f717aa097099ff56c6f473bfdd6139732a20b16ccd293f4b21fe553aad96ea681aa4b4b342059f112ab7c5038a5a85139c400a6107a339dd95b3505803c717a956314d87b82913edb7618b4da8efc3b566705066c37e880a3d4922c263a6ae6",
+	},
+}
+
+func newChaCha(key, nonce []byte) (*chacha20.Cipher, error) {
+	if len(nonce) == chacha20.NonceSizeX {
+		return chacha20.NewX(key, nonce)
+	}
+	return chacha20.New(key, nonce)
+}
+
+func TestChaChaVectors(t *testing.T) {
+	for _, v := range chachaVectors {
+		key, nonce := testutil.Unhex(v.key), testutil.Unhex(v.nonce)
+		plaintext, want := testutil.Unhex(v.plaintext), testutil.Unhex(v.ciphertext)
+
+		c, err := newChaCha(key, nonce)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		c.SetCounter(v.counter)
+		got := make([]byte, len(plaintext))
+		c.XORKeyStream(got, plaintext)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %x, want %x", v.name, got, want)
+		}
+
+		if v.counter != 0 {
+			continue
+		}
+		out, err := c.Encrypt(make([]byte, c.EncryptedSize(len(plaintext))), plaintext)
+		if err != nil {
+			t.Fatalf("%s: Encrypt failed with: %v", v.name, err)
+		}
+		if !bytes.Equal(out, append(nonce, want...)) {
+			t.Fatalf("%s: Encrypt got %x, want nonce||%x", v.name, out, want)
+		}
+		back, err := c.Decrypt(make([]byte, len(plaintext)), out)
+		if err != nil || !bytes.Equal(back, plaintext) {
+			t.Fatalf("%s: Decrypt got %x, %v", v.name, back, err)
+		}
+	}
+
+	// the HChaCha20 vector of draft-irtf-cfrg-xchacha section 2.2.1
+	subkey, err := chacha20.HChaCha20(testutil.Unhex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"), testutil.Unhex("000000090000004a0000000031415927"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testutil.Unhex("82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc"); !bytes.Equal(subkey, want) {
+		t.Fatalf("HChaCha20: got %x, want %x", subkey, want)
+	}
+}
+
+// TestChaChaSeek checks that the key stream doesn't depend on how it is
+// cut into pieces or where it is sought to, and that the end of the
+// counter is refused.
+func TestChaChaSeek(t *testing.T) {
+	key, nonce := make([]byte, chacha20.KeySize), make([]byte, chacha20.NonceSize)
+	for k := range key {
+		key[k] = byte(k)
+	}
+
+	c, err := chacha20.New(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make([]byte, 1000)
+	c.XORKeyStream(stream, stream)
+
+	for _, step := range []int{1, 7, 63, 64, 65, 130} {
+		c, _ := chacha20.New(key, nonce)
+		got := make([]byte, len(stream))
+		for i := 0; i < len(got); i += step {
+			end := i + step
+			if end > len(got) {
+				end = len(got)
+			}
+			c.XORKeyStream(got[i:end], got[i:end])
+		}
+		if !bytes.Equal(got, stream) {
+			t.Fatalf("key stream in pieces of %d differs", step)
+		}
+	}
+
+	for _, offset := range []int64{0, 1, 63, 64, 65, 500, 999} {
+		c, _ := chacha20.New(key, nonce)
+		if _, err := c.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(stream)-int(offset))
+		c.XORKeyStream(got, got)
+		if !bytes.Equal(got, stream[offset:]) {
+			t.Fatalf("key stream from offset %d differs", offset)
+		}
+
+		if pos, err := c.Seek(-int64(len(got)), io.SeekCurrent); err != nil || pos != offset {
+			t.Fatalf("seek back from the end got %d, %v, want %d", pos, err, offset)
+		}
+	}
+
+	c.SetCounter(1<<32 - 1)
+	if err := c.CheckLength(64); err != nil {
+		t.Fatalf("last block refused: %v", err)
+	}
+	if err := c.CheckLength(65); err != chacha20.ErrCounterOverflow {
+		t.Fatalf("block after the last one returned %v", err)
+	}
+	if _, err := c.Seek(1<<38+1, io.SeekStart); err != chacha20.ErrCounterOverflow {
+		t.Fatalf("seek past the key stream returned %v", err)
+	}
+}
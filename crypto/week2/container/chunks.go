@@ -0,0 +1,247 @@
+package container
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	errOpen         = errors.New("container: message authentication failed")
+	errWriterClosed = errors.New("container: write to closed writer")
+)
+
+// chunkNonce returns nonce with the chunk index XORed into its last 8
+// bytes, so no two chunks share a nonce.
+func chunkNonce(nonce []byte, index uint64) []byte {
+	n := append([]byte(nil), nonce...)
+	tail := n[len(n)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^index)
+	return n
+}
+
+// chunkAD returns the associated data of a chunk: the header, so it can't
+// be changed, and whether the chunk is the last one, so the body can't be
+// cut short at a chunk boundary.
+func chunkAD(header []byte, last bool) []byte {
+	ad := append([]byte(nil), header...)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// SealChunks seals plaintext in chunks of chunkSize bytes, or in one chunk
+// if chunkSize is 0, binding every chunk to header. There is always at
+// least one chunk, the last one, which may be empty.
+func SealChunks(aead cipher.AEAD, nonce, header, plaintext []byte, chunkSize int) []byte {
+	if chunkSize <= 0 {
+		chunkSize = len(plaintext)
+	}
+
+	var out []byte
+	for index := uint64(0); ; index++ {
+		n := chunkSize
+		last := len(plaintext) <= chunkSize
+		if last {
+			n = len(plaintext)
+		}
+
+		out = aead.Seal(out, chunkNonce(nonce, index), plaintext[:n], chunkAD(header, last))
+		plaintext = plaintext[n:]
+		if last {
+			return out
+		}
+	}
+}
+
+// OpenChunks opens what SealChunks returns. It fails if any chunk was
+// changed, moved, dropped or added, or if the header differs.
+func OpenChunks(aead cipher.AEAD, nonce, header, body []byte, chunkSize int) ([]byte, error) {
+	sealedSize := chunkSize + aead.Overhead()
+	if chunkSize <= 0 {
+		sealedSize = len(body)
+	}
+
+	var out []byte
+	for index := uint64(0); ; index++ {
+		n := sealedSize
+		// a whole chunk at the very end is still the last one
+		last := len(body) <= sealedSize
+		if last {
+			n = len(body)
+		}
+
+		var err error
+		out, err = aead.Open(out, chunkNonce(nonce, index), body[:n], chunkAD(header, last))
+		if err != nil {
+			return nil, errOpen
+		}
+		body = body[n:]
+		if last {
+			return out, nil
+		}
+	}
+}
+
+type sealWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	nonce  []byte
+	header []byte
+	// chunk holds the plaintext of the next chunk, which is only sealed
+	// once more data or Close tells whether it is the last one.
+	chunk     []byte
+	chunkSize int
+	out       []byte
+	index     uint64
+	err       error
+}
+
+// NewSealWriter returns a writer that seals everything written to it into
+// chunks of chunkSize bytes and writes them to w, the same body SealChunks
+// returns. Close must be called to seal the last chunk; it does not close
+// w. It returns nil if chunkSize isn't positive, as a single chunk can't be
+// sealed before all of it is there.
+func NewSealWriter(w io.Writer, aead cipher.AEAD, nonce, header []byte, chunkSize int) io.WriteCloser {
+	if chunkSize <= 0 {
+		return nil
+	}
+
+	return &sealWriter{
+		w:         w,
+		aead:      aead,
+		nonce:     nonce,
+		header:    header,
+		chunkSize: chunkSize,
+	}
+}
+
+func (sw *sealWriter) seal(last bool) error {
+	sw.out = sw.aead.Seal(sw.out[:0], chunkNonce(sw.nonce, sw.index), sw.chunk, chunkAD(sw.header, last))
+	sw.index++
+	sw.chunk = sw.chunk[:0]
+
+	_, err := sw.w.Write(sw.out)
+	return err
+}
+
+func (sw *sealWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(sw.chunk) == sw.chunkSize {
+			// more data follows, so this isn't the last chunk
+			if sw.err = sw.seal(false); sw.err != nil {
+				return written, sw.err
+			}
+		}
+
+		k := sw.chunkSize - len(sw.chunk)
+		if k > len(p) {
+			k = len(p)
+		}
+		sw.chunk = append(sw.chunk, p[:k]...)
+		p = p[k:]
+		written += k
+	}
+
+	return written, nil
+}
+
+// Close seals and writes the last chunk, which may be empty.
+func (sw *sealWriter) Close() error {
+	if sw.err != nil {
+		if sw.err == errWriterClosed {
+			return nil
+		}
+		return sw.err
+	}
+
+	if sw.err = sw.seal(true); sw.err != nil {
+		return sw.err
+	}
+
+	sw.err = errWriterClosed
+	return nil
+}
+
+type openReader struct {
+	r          io.Reader
+	aead       cipher.AEAD
+	nonce      []byte
+	header     []byte
+	sealedSize int
+	// in holds the sealed bytes read ahead of the chunk being opened.
+	in    bytes.Buffer
+	plain []byte
+	ready []byte
+	index uint64
+	err   error
+}
+
+// NewOpenReader returns a reader of the plaintext of the chunks of
+// chunkSize bytes that SealChunks or NewSealWriter wrote, read from r. A
+// chunk is opened as a whole before any of it is returned, and one that
+// was changed, moved, dropped or added is an error instead of io.EOF. It
+// returns nil if chunkSize isn't positive.
+func NewOpenReader(r io.Reader, aead cipher.AEAD, nonce, header []byte, chunkSize int) io.Reader {
+	if chunkSize <= 0 {
+		return nil
+	}
+
+	return &openReader{
+		r:          r,
+		aead:       aead,
+		nonce:      nonce,
+		header:     header,
+		sealedSize: chunkSize + aead.Overhead(),
+	}
+}
+
+// next opens the next chunk. Whether it is the last one depends on what
+// comes after it, so one byte more than a chunk is read ahead; the buffer
+// only grows as the data arrives, whatever chunk size a header claims.
+func (or *openReader) next() error {
+	want := int64(or.sealedSize + 1 - or.in.Len())
+	if _, err := io.CopyN(&or.in, or.r, want); err != nil && err != io.EOF {
+		return err
+	}
+
+	// a whole chunk at the very end is still the last one
+	n := or.in.Len()
+	last := n <= or.sealedSize
+	if !last {
+		n = or.sealedSize
+	}
+
+	var err error
+	or.plain, err = or.aead.Open(or.plain[:0], chunkNonce(or.nonce, or.index), or.in.Next(n), chunkAD(or.header, last))
+	if err != nil {
+		return errOpen
+	}
+	or.index++
+	or.ready = or.plain
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+func (or *openReader) Read(p []byte) (int, error) {
+	for len(or.ready) == 0 {
+		if or.err != nil {
+			return 0, or.err
+		}
+		or.err = or.next()
+	}
+
+	n := copy(p, or.ready)
+	or.ready = or.ready[n:]
+	return n, nil
+}
@@ -0,0 +1,259 @@
+// Package container defines the self-describing file format of the week2
+// tool, so a file says how it was encrypted and stays decryptable without
+// anything kept on the side. A file is a header, the body and, if the
+// header asks for one, a MAC over both:
+//
+//	magic    "W2CT"
+//	version  1 byte, 1
+//	cipher   1 byte, Cipher*
+//	mode     1 byte, Mode*
+//	flags    1 byte, bit 0: KDF parameters follow
+//	kdf      kdf.Params.Marshal, if flagged
+//	iv       1 byte length, then the IV or nonce
+//	mac      1 byte, MAC*; the tag trails the body
+//	chunk    4 bytes big endian, the plaintext chunk size of the AEAD
+//	         modes, 0 for a single chunk; always 0 for the other modes
+//
+// The body is the mode's ciphertext without the IV, or for the AEAD modes
+// the chunks of SealChunks.
+//
+// The numbers are part of the format and must never be reused; a new
+// layout gets a new version, which older parsers refuse.
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+)
+
+// Magic starts every container.
+const Magic = "W2CT"
+
+// Version1 is the only version there is so far.
+const Version1 byte = 1
+
+// MaxHeaderSize bounds the length of a header, so a reader knows how much
+// of a file to look at: the fixed fields, scrypt parameters with a 255
+// byte salt and a 255 byte IV.
+const MaxHeaderSize = len(Magic) + 4 + (1 + 9 + 1 + 255) + (1 + 255) + 1 + 4
+
+// Ciphers, named by their key size.
+const (
+	CipherAES128   byte = 1
+	CipherAES192   byte = 2
+	CipherAES256   byte = 3
+	CipherChaCha20 byte = 4
+)
+
+// Modes.
+const (
+	ModeCBC               byte = 1
+	ModeCTR               byte = 2
+	ModeChaCha20          byte = 3
+	ModeChaCha20Poly1305  byte = 4
+	ModeXChaCha20Poly1305 byte = 5
+	ModeECB               byte = 6
+	ModeCFB               byte = 7
+	ModeCFB8              byte = 8
+	ModeOFB               byte = 9
+	ModePCBC              byte = 10
+)
+
+// MACs that can trail the body.
+const (
+	MACNone       byte = 0
+	MACHMACSHA256 byte = 1
+)
+
+const flagKDF = 1
+
+var (
+	ErrMagic   = errors.New("container: not a week2 container")
+	ErrVersion = errors.New("container: unsupported version")
+	ErrHeader  = errors.New("container: invalid header")
+)
+
+// modeInfo is what the format knows about a mode: the IV or nonce length
+// and whether it is an AEAD, which is what may be chunked.
+type modeInfo struct {
+	ivSize int
+	chacha bool
+	aead   bool
+}
+
+var modeInfos = map[byte]modeInfo{
+	ModeCBC:               {16, false, false},
+	ModeCTR:               {16, false, false},
+	ModeChaCha20:          {12, true, false},
+	ModeChaCha20Poly1305:  {12, true, true},
+	ModeXChaCha20Poly1305: {24, true, true},
+	ModeECB:               {0, false, false},
+	ModeCFB:               {16, false, false},
+	ModeCFB8:              {16, false, false},
+	ModeOFB:               {16, false, false},
+	ModePCBC:              {16, false, false},
+}
+
+// CipherForKey returns the cipher of a mode with a key of keySize bytes,
+// or 0 if there is none.
+func CipherForKey(mode byte, keySize int) byte {
+	info, ok := modeInfos[mode]
+	switch {
+	case !ok:
+		return 0
+	case info.chacha && keySize == 32:
+		return CipherChaCha20
+	case info.chacha:
+		return 0
+	case keySize == 16:
+		return CipherAES128
+	case keySize == 24:
+		return CipherAES192
+	case keySize == 32:
+		return CipherAES256
+	}
+
+	return 0
+}
+
+// KeySize returns the key size of a cipher.
+func KeySize(cipher byte) int {
+	switch cipher {
+	case CipherAES128:
+		return 16
+	case CipherAES192:
+		return 24
+	case CipherAES256, CipherChaCha20:
+		return 32
+	}
+
+	return 0
+}
+
+// IVSize returns the IV or nonce size of a mode.
+func IVSize(mode byte) int {
+	return modeInfos[mode].ivSize
+}
+
+// IsAEAD reports whether the mode is an AEAD, whose body is chunked.
+func IsAEAD(mode byte) bool {
+	return modeInfos[mode].aead
+}
+
+// Header is everything needed to decrypt a body besides the key or
+// passphrase.
+type Header struct {
+	Version byte
+	Cipher  byte
+	Mode    byte
+	// KDF is nil if the key was given instead of a passphrase.
+	KDF *kdf.Params
+	IV  []byte
+	MAC byte
+	// ChunkSize is the plaintext size of the AEAD chunks but the last,
+	// 0 for one chunk.
+	ChunkSize uint32
+}
+
+func (h *Header) check() error {
+	info, ok := modeInfos[h.Mode]
+	if !ok {
+		return fmt.Errorf("container: unknown mode %d", h.Mode)
+	}
+	if KeySize(h.Cipher) == 0 || info.chacha != (h.Cipher == CipherChaCha20) {
+		return fmt.Errorf("container: cipher %d doesn't go with mode %d", h.Cipher, h.Mode)
+	}
+	if len(h.IV) != info.ivSize {
+		return fmt.Errorf("container: mode %d needs a %d byte IV, not %d", h.Mode, info.ivSize, len(h.IV))
+	}
+	if h.MAC != MACNone && h.MAC != MACHMACSHA256 {
+		return fmt.Errorf("container: unknown MAC %d", h.MAC)
+	}
+	if h.ChunkSize != 0 && !info.aead {
+		return fmt.Errorf("container: mode %d can't be chunked", h.Mode)
+	}
+
+	return nil
+}
+
+// TagSize returns the size of the trailing MAC.
+func (h *Header) TagSize() int {
+	if h.MAC == MACHMACSHA256 {
+		return 32
+	}
+	return 0
+}
+
+// Marshal returns the header as it starts the container. It panics if the
+// fields don't go together, as a header that can't be parsed back is a bug.
+func (h *Header) Marshal() []byte {
+	if h.Version != Version1 {
+		panic(ErrVersion.Error())
+	}
+	if err := h.check(); err != nil {
+		panic(err.Error())
+	}
+
+	out := append([]byte(Magic), h.Version, h.Cipher, h.Mode, 0)
+	if h.KDF != nil {
+		out[len(out)-1] |= flagKDF
+		out = append(out, h.KDF.Marshal()...)
+	}
+	out = append(out, byte(len(h.IV)))
+	out = append(out, h.IV...)
+	out = append(out, h.MAC)
+
+	var chunk [4]byte
+	binary.BigEndian.PutUint32(chunk[:], h.ChunkSize)
+	return append(out, chunk[:]...)
+}
+
+// ParseHeader parses the header at the start of data and returns it with
+// its length. It returns ErrMagic if data isn't a container, ErrVersion
+// for a version it doesn't know and ErrHeader or a more specific error
+// for a header that is cut short or doesn't make sense.
+func ParseHeader(data []byte) (*Header, int, error) {
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, 0, ErrMagic
+	}
+	n := len(Magic)
+	if len(data) < n+4 {
+		return nil, 0, ErrHeader
+	}
+	if data[n] != Version1 {
+		return nil, 0, ErrVersion
+	}
+
+	h := &Header{Version: data[n], Cipher: data[n+1], Mode: data[n+2]}
+	flags := data[n+3]
+	n += 4
+	if flags&^flagKDF != 0 {
+		return nil, 0, ErrHeader
+	}
+
+	if flags&flagKDF != 0 {
+		params, k, err := kdf.ParseParams(data[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		h.KDF = params
+		n += k
+	}
+
+	if len(data) < n+1 || len(data) < n+1+int(data[n])+5 {
+		return nil, 0, ErrHeader
+	}
+	h.IV = append([]byte(nil), data[n+1:n+1+int(data[n])]...)
+	n += 1 + int(data[n])
+	h.MAC = data[n]
+	h.ChunkSize = binary.BigEndian.Uint32(data[n+1:])
+	n += 5
+
+	if err := h.check(); err != nil {
+		return nil, 0, err
+	}
+	return h, n, nil
+}
@@ -0,0 +1,192 @@
+package container_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/lumieru/coursera/crypto/week2/chacha20"
+	"github.com/lumieru/coursera/crypto/week2/container"
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+)
+
+// goldenHeader is a version 1 header with every field used; its bytes
+// and the chunks of goldenBody, which were put together with the
+// cryptography package's ChaCha20Poly1305, must never change, or old
+// files stop decrypting.
+var goldenHeader = container.Header{
+	Version: container.Version1,
+	Cipher:  container.CipherChaCha20,
+	Mode:    container.ModeChaCha20Poly1305,
+	KDF: &kdf.Params{
+		KDF:        kdf.PBKDF2SHA256,
+		Salt:       testutil.Unhex("000102030405060708090a0b0c0d0e0f"),
+		Iterations: 1000,
+	},
+	IV:        testutil.Unhex("000102030405060708090a0b"),
+	MAC:       container.MACHMACSHA256,
+	ChunkSize: 4,
+}
+
+const (
+	goldenHeaderHex = "57324354 01 04 04 01 01 000003e8 10 000102030405060708090a0b0c0d0e0f 0c 000102030405060708090a0b 01 00000004"
+	goldenBodyHex   = "558709c3be25b2452f860413a7b9a6b7bdb5ac43 b16696009dfbe7ad85ed8da93994a41dbd972410 2ac6dd4c617542e8d800890cb72b47488037"
+)
+
+func TestContainerFormat(t *testing.T) {
+	header := goldenHeader.Marshal()
+	if want := testutil.Unhex(goldenHeaderHex); !bytes.Equal(header, want) {
+		t.Fatalf("header got %x, want %x", header, want)
+	}
+
+	h, n, err := container.ParseHeader(append(header, 0xaa))
+	if err != nil {
+		t.Fatalf("ParseHeader failed with: %v", err)
+	}
+	if n != len(header) || !bytes.Equal(h.Marshal(), header) {
+		t.Fatalf("header parsed to %+v, %d bytes", h, n)
+	}
+
+	for k := 0; k < len(header); k++ {
+		if _, _, err := container.ParseHeader(header[:k]); err == nil {
+			t.Fatalf("header cut to %d bytes parsed", k)
+		}
+	}
+
+	for _, version := range []byte{0, 2, 0xff} {
+		bad := append([]byte(nil), header...)
+		bad[4] = version
+		if _, _, err := container.ParseHeader(bad); err != container.ErrVersion {
+			t.Fatalf("version %d returned %v", version, err)
+		}
+	}
+
+	corrupt := []struct {
+		name   string
+		offset int
+		value  byte
+	}{
+		{"magic", 0, 'X'},
+		{"AES with a ChaCha20 mode", 5, container.CipherAES256},
+		{"unknown cipher", 5, 9},
+		{"unknown mode", 6, 99},
+		{"unknown flag", 7, 3},
+		{"IV length", 30, 16},
+		{"unknown MAC", 43, 7},
+	}
+	for _, c := range corrupt {
+		bad := append([]byte(nil), header...)
+		bad[c.offset] = c.value
+		if _, _, err := container.ParseHeader(bad); err == nil {
+			t.Fatalf("header with %s parsed", c.name)
+		}
+	}
+
+	// a chunk size only makes sense for the AEAD modes
+	cbc := &container.Header{Version: container.Version1, Cipher: container.CipherAES128, Mode: container.ModeCBC, IV: make([]byte, 16)}
+	bad := cbc.Marshal()
+	bad[len(bad)-1] = 1
+	if _, _, err := container.ParseHeader(bad); err == nil {
+		t.Fatalf("chunked CBC header parsed")
+	}
+}
+
+func TestContainerChunks(t *testing.T) {
+	aead, err := chacha20.NewAEAD(testutil.Unhex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := testutil.Unhex(goldenHeaderHex)
+	nonce := goldenHeader.IV
+	sealed := aead.Overhead() + 4
+
+	body := container.SealChunks(aead, nonce, header, []byte("0123456789"), 4)
+	if want := testutil.Unhex(goldenBodyHex); !bytes.Equal(body, want) {
+		t.Fatalf("body got %x, want %x", body, want)
+	}
+
+	for _, size := range []int{0, 1, 4, 8, 9} {
+		plaintext := []byte("0123456789")[:size]
+		for _, chunkSize := range []int{0, 1, 4, 8} {
+			body := container.SealChunks(aead, nonce, header, plaintext, chunkSize)
+			got, err := container.OpenChunks(aead, nonce, header, body, chunkSize)
+			if err != nil || !bytes.Equal(got, plaintext) {
+				t.Fatalf("%d bytes in chunks of %d: got %q, %v", size, chunkSize, got, err)
+			}
+		}
+	}
+
+	tampered := map[string][]byte{
+		"last chunk dropped": body[:2*sealed],
+		"chunks swapped":     append(append(append([]byte(nil), body[sealed:2*sealed]...), body[:sealed]...), body[2*sealed:]...),
+		"chunk added":        append(append([]byte(nil), body...), body[2*sealed:]...),
+		"empty":              nil,
+	}
+	for name, bad := range tampered {
+		if _, err := container.OpenChunks(aead, nonce, header, bad, 4); err == nil {
+			t.Fatalf("body with %s opened", name)
+		}
+	}
+
+	otherHeader := append([]byte(nil), header...)
+	otherHeader[len(otherHeader)-1] = 5
+	if _, err := container.OpenChunks(aead, nonce, otherHeader, body, 4); err == nil {
+		t.Fatalf("body opened under another header")
+	}
+}
+
+// TestChunkStreams checks that NewSealWriter and NewOpenReader, written
+// to and read from a byte at a time, agree with SealChunks and OpenChunks.
+func TestChunkStreams(t *testing.T) {
+	aead, err := chacha20.NewAEAD(testutil.Unhex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := testutil.Unhex(goldenHeaderHex)
+	nonce := goldenHeader.IV
+	sealed := aead.Overhead() + 4
+
+	for size := 0; size <= 10; size++ {
+		plaintext := []byte("0123456789")[:size]
+		for _, chunkSize := range []int{1, 4, 8, 10, 11} {
+			want := container.SealChunks(aead, nonce, header, plaintext, chunkSize)
+
+			var buf bytes.Buffer
+			w := container.NewSealWriter(&buf, aead, nonce, header, chunkSize)
+			for k := range plaintext {
+				if _, err := w.Write(plaintext[k : k+1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil || !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("%d bytes in chunks of %d: writer got %x, %v, want %x", size, chunkSize, buf.Bytes(), err, want)
+			}
+
+			got, err := ioutil.ReadAll(container.NewOpenReader(iotest.OneByteReader(bytes.NewReader(want)), aead, nonce, header, chunkSize))
+			if err != nil || !bytes.Equal(got, plaintext) {
+				t.Fatalf("%d bytes in chunks of %d: reader got %q, %v", size, chunkSize, got, err)
+			}
+		}
+	}
+
+	body := testutil.Unhex(goldenBodyHex)
+	tampered := map[string][]byte{
+		"last chunk dropped":   body[:2*sealed],
+		"cut in a chunk":       body[:len(body)-1],
+		"chunk added":          append(append([]byte(nil), body...), body[2*sealed:]...),
+		"first chunk repeated": append(append([]byte(nil), body[:sealed]...), body...),
+		"empty":                nil,
+	}
+	for name, bad := range tampered {
+		got, err := ioutil.ReadAll(container.NewOpenReader(bytes.NewReader(bad), aead, nonce, header, 4))
+		if err == nil {
+			t.Errorf("body with %s read as %q", name, got)
+		}
+	}
+
+	if container.NewSealWriter(ioutil.Discard, aead, nonce, header, 0) != nil || container.NewOpenReader(bytes.NewReader(body), aead, nonce, header, 0) != nil {
+		t.Errorf("a single chunk was streamed")
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/lumieru/coursera/crypto/week2/container"
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+	"github.com/lumieru/coursera/crypto/week2/openssl"
+)
+
+var (
+	formatFlag    = flag.String("format", "container", "Format: container, which records the mode, IV and KDF, bare IV||ciphertext, or openssl for openssl enc files. Decryption detects containers.")
+	chunkSizeFlag = flag.Int("chunk-size", 64<<10, "Plaintext bytes per chunk for the AEAD modes in a container, 0 for one chunk.")
+
+	opensslCipherFlag = flag.String("openssl-cipher", "aes-128-cbc", "openssl enc cipher for -format openssl: aes-128-cbc to aes-256-ctr. Replaces -mode.")
+	mdFlag            = flag.String("md", "sha256", "openssl enc -md digest for -format openssl: md5, sha1, sha256 or sha512.")
+	pbkdf2Flag        = flag.Bool("pbkdf2", false, "Use PBKDF2 like openssl enc -pbkdf2 for -format openssl; -iter implies it, and it defaults to 10000 iterations there.")
+	iterFlag          = flag.Int("iter", 0, "PBKDF2 iterations like openssl enc -iter for -format openssl; implies -pbkdf2. See -kdf-iter for containers.")
+)
+
+// containerModes maps the mode types to their numbers in a container,
+// which unlike the types never change.
+var containerModes = map[int]byte{
+	TYPE_CBC:                container.ModeCBC,
+	TYPE_CTR:                container.ModeCTR,
+	TYPE_CHACHA20:           container.ModeChaCha20,
+	TYPE_CHACHA20_POLY1305:  container.ModeChaCha20Poly1305,
+	TYPE_XCHACHA20_POLY1305: container.ModeXChaCha20Poly1305,
+	TYPE_ECB:                container.ModeECB,
+	TYPE_CFB:                container.ModeCFB,
+	TYPE_CFB8:               container.ModeCFB8,
+	TYPE_OFB:                container.ModeOFB,
+	TYPE_PCBC:               container.ModePCBC,
+}
+
+func modeFromContainer(m byte) (int, error) {
+	for mode, cm := range containerModes {
+		if cm == m {
+			return mode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown container mode %d", m)
+}
+
+// encryptContainer encrypts what r holds in the given mode into a
+// container written to w, with key or with keys derived from passphrase
+// with params, and a random IV. Chunked AEAD modes stream, the others
+// read all of r first.
+func encryptContainer(mode int, key, passphrase []byte, params *kdf.Params, r io.Reader, w io.Writer) error {
+	h := &container.Header{
+		Version: container.Version1,
+		Mode:    containerModes[mode],
+		MAC:     container.MACNone,
+	}
+
+	var macKey []byte
+	if passphrase != nil {
+		var err error
+		key, macKey, err = params.DeriveKeys(passphrase, passphraseKeySize, passphraseMACSize)
+		if err != nil {
+			return err
+		}
+		h.KDF = params
+		h.MAC = container.MACHMACSHA256
+	}
+	h.Cipher = container.CipherForKey(h.Mode, len(key))
+	if h.Cipher == 0 {
+		return fmt.Errorf("no cipher for mode %s with a %d byte key", *modeFlag, len(key))
+	}
+	h.IV = make([]byte, container.IVSize(h.Mode))
+	if _, err := rand.Read(h.IV); err != nil {
+		return err
+	}
+
+	var aead cipher.AEAD
+	if container.IsAEAD(h.Mode) {
+		var err error
+		aead, err = newModeAEAD(mode, key)
+		if err != nil {
+			return err
+		}
+		if *chunkSizeFlag < 0 || int64(*chunkSizeFlag) > 1<<32-1 {
+			return errors.New("chunk size out of range")
+		}
+		h.ChunkSize = uint32(*chunkSizeFlag)
+	}
+	header := h.Marshal()
+
+	// the MAC covers the header and the body
+	out := w
+	var mac hash.Hash
+	if macKey != nil {
+		mac = hmac.New(sha256.New, macKey)
+		out = io.MultiWriter(w, mac)
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	if aead != nil && h.ChunkSize > 0 {
+		sw := container.NewSealWriter(out, aead, h.IV, header, int(h.ChunkSize))
+		if _, err := io.Copy(sw, r); err != nil {
+			return err
+		}
+		if err := sw.Close(); err != nil {
+			return err
+		}
+	} else {
+		msg, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var body []byte
+		if aead != nil {
+			body = container.SealChunks(aead, h.IV, header, msg, 0)
+		} else {
+			dst, err := encryptMode(mode, key, h.IV, msg)
+			if err != nil {
+				return err
+			}
+			// the IV is in the header
+			body = dst[len(h.IV):]
+		}
+		if _, err := out.Write(body); err != nil {
+			return err
+		}
+	}
+
+	if mac != nil {
+		_, err := w.Write(mac.Sum(nil))
+		return err
+	}
+	return nil
+}
+
+// opensslKDF returns the openssl enc key derivation of the flags. As with
+// openssl, -iter turns on PBKDF2 and -pbkdf2 alone means 10000 iterations;
+// -iter 0 is the same as leaving it out.
+func opensslKDF() (openssl.KDF, error) {
+	h, err := openssl.Digest(*mdFlag)
+	if err != nil {
+		return openssl.KDF{}, err
+	}
+
+	k := openssl.KDF{Hash: h}
+	switch {
+	case *iterFlag < 0:
+		return openssl.KDF{}, errors.New("-iter must be positive")
+	case *iterFlag > 0:
+		k.Iterations = *iterFlag
+	case *pbkdf2Flag:
+		k.Iterations = openssl.DefaultIterations
+	}
+	return k, nil
+}
+
+// isContainer reports whether what br holds should be decrypted as a
+// container.
+func isContainer(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(container.Magic))
+	return *formatFlag == "container" && string(magic) == container.Magic
+}
+
+// trailerReader reads all of br but the last n bytes, the MAC that ends a
+// container, and keeps them in tag once it reaches the end.
+type trailerReader struct {
+	br  *bufio.Reader
+	n   int
+	tag []byte
+}
+
+func (tr *trailerReader) Read(p []byte) (int, error) {
+	peek, err := tr.br.Peek(tr.n + 1)
+	if len(peek) <= tr.n {
+		if err != io.EOF {
+			return 0, err
+		}
+		if len(peek) < tr.n {
+			return 0, errShortMAC
+		}
+		tr.tag = append([]byte(nil), peek...)
+		return 0, io.EOF
+	}
+
+	// Read takes only what is buffered, which is more than the trailer
+	k := tr.br.Buffered() - tr.n
+	if k > len(p) {
+		k = len(p)
+	}
+	return tr.br.Read(p[:k])
+}
+
+var (
+	errShortMAC = errors.New("container too short for its MAC")
+	errMAC      = errors.New("wrong passphrase or corrupted container")
+)
+
+// decryptContainer decrypts the container br holds to w with key, or with
+// keys derived from passphrase if it has KDF parameters. Chunked AEAD
+// modes stream, each chunk being authenticated before it is written; the
+// others read all of br and check the MAC before writing anything.
+func decryptContainer(key, passphrase []byte, br *bufio.Reader, w io.Writer) error {
+	// a short read only makes for a short header, which ParseHeader rejects
+	peek, _ := br.Peek(container.MaxHeaderSize)
+	h, n, err := container.ParseHeader(peek)
+	if err != nil {
+		return err
+	}
+	header := append([]byte(nil), peek[:n]...)
+	br.Discard(n)
+	mode, err := modeFromContainer(h.Mode)
+	if err != nil {
+		return err
+	}
+
+	var macKey []byte
+	switch {
+	case h.KDF != nil && passphrase == nil:
+		return errors.New("container needs a passphrase")
+	case h.KDF == nil && passphrase != nil:
+		return errors.New("container needs a key, not a passphrase")
+	case h.KDF != nil:
+		key, macKey, err = h.KDF.DeriveKeys(passphrase, passphraseKeySize, passphraseMACSize)
+		if err != nil {
+			return err
+		}
+	}
+	if len(key) != container.KeySize(h.Cipher) {
+		return fmt.Errorf("container needs a %d byte key", container.KeySize(h.Cipher))
+	}
+
+	var mac hash.Hash
+	if h.MAC == container.MACHMACSHA256 {
+		if macKey == nil {
+			return errors.New("container MAC needs a passphrase")
+		}
+		mac = hmac.New(sha256.New, macKey)
+		mac.Write(header)
+	}
+
+	if container.IsAEAD(h.Mode) && h.ChunkSize > 0 {
+		aead, err := newModeAEAD(mode, key)
+		if err != nil {
+			return err
+		}
+		tr := &trailerReader{br: br, n: h.TagSize()}
+		var body io.Reader = tr
+		if mac != nil {
+			body = io.TeeReader(tr, mac)
+		}
+		if _, err := io.Copy(w, container.NewOpenReader(body, aead, h.IV, header, int(h.ChunkSize))); err != nil {
+			return err
+		}
+		if mac != nil && !hmac.Equal(mac.Sum(nil), tr.tag) {
+			return errMAC
+		}
+		return nil
+	}
+
+	rest, err := ioutil.ReadAll(br)
+	if err != nil {
+		return err
+	}
+	tagged := len(rest) - h.TagSize()
+	if tagged < 0 {
+		return errShortMAC
+	}
+	if mac != nil {
+		mac.Write(rest[:tagged])
+		if !hmac.Equal(mac.Sum(nil), rest[tagged:]) {
+			return errMAC
+		}
+	}
+
+	var dst []byte
+	if container.IsAEAD(h.Mode) {
+		aead, err := newModeAEAD(mode, key)
+		if err != nil {
+			return err
+		}
+		dst, err = container.OpenChunks(aead, h.IV, header, rest[:tagged], 0)
+	} else {
+		dst, err = decryptMode(mode, key, make([]byte, 16), append(h.IV, rest[:tagged]...))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dst)
+	return err
+}
+
+func encryptOpenSSL(passphrase, msg []byte) ([]byte, error) {
+	k, err := opensslKDF()
+	if err != nil {
+		return nil, err
+	}
+
+	return openssl.Encrypt(*opensslCipherFlag, k, passphrase, nil, msg)
+}
+
+func decryptOpenSSL(passphrase, src []byte) ([]byte, error) {
+	k, err := opensslKDF()
+	if err != nil {
+		return nil, err
+	}
+
+	return openssl.Decrypt(*opensslCipherFlag, k, passphrase, src)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/container"
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+)
+
+// sealContainer returns the container encryptContainer makes of msg.
+func sealContainer(t *testing.T, mode int, key, passphrase []byte, params *kdf.Params, msg []byte) []byte {
+	var wire bytes.Buffer
+	if err := encryptContainer(mode, key, passphrase, params, bytes.NewReader(msg), &wire); err != nil {
+		t.Fatalf("mode %d: encrypt failed with: %v", mode, err)
+	}
+	return wire.Bytes()
+}
+
+// openContainer returns what decryptContainer makes of src.
+func openContainer(key, passphrase, src []byte) ([]byte, error) {
+	var plain bytes.Buffer
+	err := decryptContainer(key, passphrase, bufio.NewReader(bytes.NewReader(src)), &plain)
+	return plain.Bytes(), err
+}
+
+// modeKey returns a key for mode.
+func modeKey(mode int) []byte {
+	if b, _ := newModeCipher(mode, testKey); b == nil {
+		return bytes.Repeat(testKey, 2)
+	}
+	return testKey
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	defer func(size int) { *chunkSizeFlag = size }(*chunkSizeFlag)
+
+	for mode := range containerModes {
+		for _, chunkSize := range []int{0, 1000} {
+			*chunkSizeFlag = chunkSize
+			for _, size := range []int{0, 1, 1000, 2500} {
+				msg := bytes.Repeat([]byte{'c'}, size)
+				wire := sealContainer(t, mode, modeKey(mode), nil, nil, msg)
+				if got, err := openContainer(modeKey(mode), nil, wire); err != nil || !bytes.Equal(got, msg) {
+					t.Errorf("mode %d, chunks of %d, %d bytes: read back %d bytes, %v", mode, chunkSize, size, len(got), err)
+				}
+			}
+		}
+	}
+}
+
+func TestModeFromContainer(t *testing.T) {
+	for mode, cm := range containerModes {
+		if got, err := modeFromContainer(cm); err != nil || got != mode {
+			t.Errorf("container mode %d: got %d, %v, want %d", cm, got, err, mode)
+		}
+	}
+	if _, err := modeFromContainer(0); err == nil {
+		t.Errorf("container mode 0 accepted")
+	}
+}
+
+func TestContainerMAC(t *testing.T) {
+	defer func(size int) { *chunkSizeFlag = size }(*chunkSizeFlag)
+	*chunkSizeFlag = 100
+
+	params, err := kdf.NewPBKDF2Params(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("correct horse")
+	msg := bytes.Repeat([]byte{'m'}, 250)
+
+	// CBC only has the HMAC, chunked ChaCha20-Poly1305 has both it and the
+	// chunk tags
+	for _, mode := range []int{TYPE_CBC, TYPE_CHACHA20_POLY1305} {
+		wire := sealContainer(t, mode, nil, passphrase, params, msg)
+		if got, err := openContainer(nil, passphrase, wire); err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("mode %d: got %q, %v", mode, got, err)
+		}
+
+		flipped := append([]byte(nil), wire...)
+		flipped[len(flipped)-1] ^= 1
+		if _, err := openContainer(nil, passphrase, flipped); err != errMAC {
+			t.Errorf("mode %d, flipped MAC byte: got %v, want errMAC", mode, err)
+		}
+		if _, err := openContainer(nil, passphrase, wire[:len(wire)-1]); err == nil {
+			t.Errorf("mode %d, cut MAC: no error", mode)
+		}
+
+		if _, err := openContainer(nil, nil, wire); err == nil {
+			t.Errorf("mode %d: decrypted without the passphrase", mode)
+		}
+		if _, err := openContainer(modeKey(mode), nil, wire); err == nil {
+			t.Errorf("mode %d: decrypted with a key instead of the passphrase", mode)
+		}
+	}
+
+	wire := sealContainer(t, TYPE_CBC, nil, passphrase, params, nil)
+	_, n, err := container.ParseHeader(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openContainer(nil, passphrase, wire[:n+10]); err != errShortMAC {
+		t.Errorf("no room for the MAC: got %v, want errShortMAC", err)
+	}
+}
+
+func TestContainerBadHeader(t *testing.T) {
+	msg := []byte("Basic CBC mode encryption needs padding.")
+	wire := sealContainer(t, TYPE_CBC, testKey, nil, nil, msg)
+	_, n, err := container.ParseHeader(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k := 0; k < n; k++ {
+		if got, err := openContainer(testKey, nil, wire[:k]); err == nil {
+			t.Errorf("header cut to %d bytes: got %q", k, got)
+		}
+	}
+
+	// the cipher and mode follow the magic and version
+	with := func(off int, b byte) []byte {
+		src := append([]byte(nil), wire...)
+		src[len(container.Magic)+off] = b
+		return src
+	}
+	tests := []struct {
+		name string
+		src  []byte
+	}{
+		{"AES-256 for a 16 byte key", with(1, container.CipherAES256)},
+		{"ChaCha20 cipher for CBC", with(1, container.CipherChaCha20)},
+		{"ChaCha20 mode for AES", with(2, container.ModeChaCha20)},
+		{"unknown mode", with(2, 99)},
+		{"unknown version", with(0, 99)},
+	}
+	for _, tt := range tests {
+		if got, err := openContainer(testKey, nil, tt.src); err == nil {
+			t.Errorf("%s: got %q", tt.name, got)
+		}
+	}
+
+	// a 32 byte key doesn't open an AES-128 container
+	if _, err := openContainer(bytes.Repeat(testKey, 2), nil, wire); err == nil {
+		t.Errorf("AES-128 container opened with a 32 byte key")
+	}
+}
+
+// TestDecryptFallback checks that decrypt takes input that isn't a
+// container for bare -mode output, and a container as one whatever -mode.
+func TestDecryptFallback(t *testing.T) {
+	msg := []byte("CTR mode lets you build a stream cipher from a block cipher.")
+
+	var bare bytes.Buffer
+	if err := encryptBare(TYPE_CTR, testKey, bytes.NewReader(msg), &bare); err != nil {
+		t.Fatal(err)
+	}
+	var plain bytes.Buffer
+	if err := decrypt(TYPE_CTR, testKey, nil, bytes.NewReader(bare.Bytes()), &plain); err != nil || !bytes.Equal(plain.Bytes(), msg) {
+		t.Errorf("bare: got %q, %v, want %q", plain.Bytes(), err, msg)
+	}
+
+	wire := sealContainer(t, TYPE_CTR, testKey, nil, nil, msg)
+	plain.Reset()
+	if err := decrypt(TYPE_CBC, testKey, nil, bytes.NewReader(wire), &plain); err != nil || !bytes.Equal(plain.Bytes(), msg) {
+		t.Errorf("container: got %q, %v, want %q", plain.Bytes(), err, msg)
+	}
+
+	// -format bare doesn't look for a container
+	defer func(format string) { *formatFlag = format }(*formatFlag)
+	*formatFlag = "bare"
+	plain.Reset()
+	if err := decrypt(TYPE_CTR, testKey, nil, bytes.NewReader(wire), &plain); err != nil || bytes.Equal(plain.Bytes(), msg) {
+		t.Errorf("-format bare decrypted a container: %v", err)
+	}
+}
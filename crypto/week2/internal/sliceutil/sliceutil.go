@@ -0,0 +1,17 @@
+// Package sliceutil holds the slice handling the week2 AEADs share.
+package sliceutil
+
+// ForAppend extends in by n bytes, reallocating if needed, and returns
+// the whole slice and the n new bytes, for a Seal or Open that appends to
+// dst.
+func ForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,18 @@
+// Package testutil holds what the tests of the week2 packages share.
+package testutil
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// Unhex decodes a hex test vector, ignoring spaces. The vectors are
+// constants, so a bad one is a bug in the test and Unhex panics.
+func Unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
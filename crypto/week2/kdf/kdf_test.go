@@ -0,0 +1,124 @@
+package kdf_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+)
+
+// pbkdf2Vectors are RFC 7914 section 11 for HMAC-SHA256 and RFC 6070 for
+// HMAC-SHA1.
+var pbkdf2Vectors = []struct {
+	name     string
+	sha1     bool
+	password string
+	salt     string
+	iter     int
+	key      string
+}{
+	{"RFC 7914 11 #1", false, "passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	{"RFC 7914 11 #2", false, "Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	{"RFC 6070 #2", true, "password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+}
+
+// scryptVectors are the first three of RFC 7914 section 12; the fourth
+// takes a gigabyte.
+var scryptVectors = []struct {
+	password string
+	salt     string
+	N, r, p  int
+	key      string
+}{
+	{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+	{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+}
+
+func TestKDFVectors(t *testing.T) {
+	for _, v := range pbkdf2Vectors {
+		h := sha256.New
+		if v.sha1 {
+			h = sha1.New
+		}
+		want := testutil.Unhex(v.key)
+		if got := kdf.PBKDF2([]byte(v.password), []byte(v.salt), v.iter, len(want), h); !bytes.Equal(got, want) {
+			t.Fatalf("PBKDF2 %s: got %x, want %x", v.name, got, want)
+		}
+	}
+
+	for _, v := range scryptVectors {
+		want := testutil.Unhex(v.key)
+		got, err := kdf.Scrypt([]byte(v.password), []byte(v.salt), v.N, v.r, v.p, len(want))
+		if err != nil {
+			t.Fatalf("scrypt N=%d: %v", v.N, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("scrypt N=%d: got %x, want %x", v.N, got, want)
+		}
+	}
+}
+
+// TestKDFParams checks that a header parses back to the same keys and
+// that truncated and hostile headers are refused.
+func TestKDFParams(t *testing.T) {
+	pbkdf2Params, err := kdf.NewPBKDF2Params(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptParams, err := kdf.NewScryptParams(1024, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := []byte("correct horse battery staple")
+	for _, params := range []*kdf.Params{pbkdf2Params, scryptParams} {
+		encKey, macKey, err := params.DeriveKeys(passphrase, 32, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(encKey, macKey) {
+			t.Fatalf("KDF %d: encryption and MAC key are equal", params.KDF)
+		}
+
+		header := params.Marshal()
+		parsed, n, err := kdf.ParseParams(append(header, 0xff))
+		if err != nil {
+			t.Fatalf("KDF %d: ParseParams failed with: %v", params.KDF, err)
+		}
+		if n != len(header) {
+			t.Fatalf("KDF %d: ParseParams read %d bytes of a %d byte header", params.KDF, n, len(header))
+		}
+		encKey2, macKey2, err := parsed.DeriveKeys(passphrase, 32, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encKey, encKey2) || !bytes.Equal(macKey, macKey2) {
+			t.Fatalf("KDF %d: keys from the parsed header differ", params.KDF)
+		}
+
+		for k := 0; k < len(header); k++ {
+			if _, _, err := kdf.ParseParams(header[:k]); err == nil {
+				t.Fatalf("KDF %d: header cut to %d bytes parsed", params.KDF, k)
+			}
+		}
+	}
+
+	hostile := [][]byte{
+		testutil.Unhex("01 00000000 00"),             // no iterations
+		testutil.Unhex("01 ffffffff 00"),             // too many iterations
+		testutil.Unhex("02 1f 00000008 00000001 00"), // N = 2^31
+		testutil.Unhex("02 16 00000040 00000001 00"), // N = 2^22, r = 64: 32 GiB
+		testutil.Unhex("02 0a 00000008 00000041 00"), // p = 65
+		testutil.Unhex("02 0a 00000000 00000001 00"), // r = 0
+		testutil.Unhex("03 00"),                      // unknown KDF
+	}
+	for _, header := range hostile {
+		if _, _, err := kdf.ParseParams(header); err == nil {
+			t.Fatalf("header %x parsed", header)
+		}
+	}
+}
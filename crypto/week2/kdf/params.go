@@ -0,0 +1,175 @@
+package kdf
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// The KDFs a Params can name.
+const (
+	PBKDF2SHA256 byte = 1
+	ScryptKDF    byte = 2
+)
+
+// SaltSize is the size of the salts New*Params pick.
+const SaltSize = 16
+
+// Limits on what ParseParams accepts, so that a header from someone else
+// can't make decryption take hours or all the memory there is. scrypt
+// needs 128*r*N bytes, and p runs it again that many times.
+const (
+	maxIterations   = 1 << 24
+	maxScryptMemory = 1 << 30
+	maxScryptLogN   = 23 // 128*2^23 bytes is maxScryptMemory with r = 1
+	maxScryptP      = 64
+)
+
+var ErrParams = errors.New("kdf: invalid parameter header")
+
+// Params are a KDF with its salt and costs. Marshal stores them as
+//
+//	PBKDF2-HMAC-SHA256: 0x01 || iterations (4 bytes) || salt length || salt
+//	scrypt:             0x02 || log2 N || r (4 bytes) || p (4 bytes) || salt length || salt
+//
+// with big-endian numbers.
+type Params struct {
+	KDF  byte
+	Salt []byte
+	// Iterations is the PBKDF2 iteration count.
+	Iterations int
+	// N, R and P are the scrypt costs.
+	N, R, P int
+}
+
+// NewPBKDF2Params returns PBKDF2-HMAC-SHA256 with iter iterations and a
+// random salt.
+func NewPBKDF2Params(iter int) (*Params, error) {
+	params := &Params{KDF: PBKDF2SHA256, Iterations: iter}
+	return params, params.init()
+}
+
+// NewScryptParams returns scrypt with the given costs and a random salt.
+func NewScryptParams(N, r, p int) (*Params, error) {
+	params := &Params{KDF: ScryptKDF, N: N, R: r, P: p}
+	return params, params.init()
+}
+
+func (params *Params) init() error {
+	if err := params.check(); err != nil {
+		return err
+	}
+
+	params.Salt = make([]byte, SaltSize)
+	_, err := rand.Read(params.Salt)
+	return err
+}
+
+func (params *Params) check() error {
+	switch params.KDF {
+	case PBKDF2SHA256:
+		if params.Iterations < 1 || params.Iterations > maxIterations {
+			return errors.New("kdf: PBKDF2 iterations out of range")
+		}
+		return nil
+	case ScryptKDF:
+		if err := checkScrypt(params.N, params.R, params.P); err != nil {
+			return err
+		}
+		if uint64(params.N)*uint64(params.R) > maxScryptMemory/128 || params.P > maxScryptP {
+			return errors.New("kdf: scrypt costs out of range")
+		}
+		return nil
+	}
+
+	return errors.New("kdf: unknown KDF")
+}
+
+// DeriveKey returns keyLen bytes derived from passphrase.
+func (params *Params) DeriveKey(passphrase []byte, keyLen int) ([]byte, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+
+	if params.KDF == PBKDF2SHA256 {
+		return PBKDF2(passphrase, params.Salt, params.Iterations, keyLen, sha256.New), nil
+	}
+	return Scrypt(passphrase, params.Salt, params.N, params.R, params.P, keyLen)
+}
+
+// DeriveKeys derives an encryption key and a MAC key from passphrase, so
+// no key is used for two things.
+func (params *Params) DeriveKeys(passphrase []byte, encKeyLen, macKeyLen int) (encKey, macKey []byte, err error) {
+	key, err := params.DeriveKey(passphrase, encKeyLen+macKeyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key[:encKeyLen], key[encKeyLen:], nil
+}
+
+// Marshal returns the header for params.
+func (params *Params) Marshal() []byte {
+	var out []byte
+	var word [4]byte
+	if params.KDF == PBKDF2SHA256 {
+		binary.BigEndian.PutUint32(word[:], uint32(params.Iterations))
+		out = append([]byte{PBKDF2SHA256}, word[:]...)
+	} else {
+		out = []byte{ScryptKDF, byte(bits.Len(uint(params.N)) - 1)}
+		binary.BigEndian.PutUint32(word[:], uint32(params.R))
+		out = append(out, word[:]...)
+		binary.BigEndian.PutUint32(word[:], uint32(params.P))
+		out = append(out, word[:]...)
+	}
+
+	out = append(out, byte(len(params.Salt)))
+	return append(out, params.Salt...)
+}
+
+// ParseParams parses the header at the start of data and returns it with
+// its length. It returns ErrParams for a truncated header or an unknown
+// KDF, and an error for costs over the limits.
+func ParseParams(data []byte) (*Params, int, error) {
+	if len(data) < 1 {
+		return nil, 0, ErrParams
+	}
+
+	params := &Params{KDF: data[0]}
+	n := 1
+	switch params.KDF {
+	case PBKDF2SHA256:
+		if len(data) < n+4 {
+			return nil, 0, ErrParams
+		}
+		params.Iterations = int(binary.BigEndian.Uint32(data[n:]))
+		n += 4
+	case ScryptKDF:
+		if len(data) < n+9 {
+			return nil, 0, ErrParams
+		}
+		logN := data[n]
+		if logN == 0 || logN > maxScryptLogN {
+			return nil, 0, errors.New("kdf: scrypt costs out of range")
+		}
+		params.N = 1 << logN
+		params.R = int(binary.BigEndian.Uint32(data[n+1:]))
+		params.P = int(binary.BigEndian.Uint32(data[n+5:]))
+		n += 9
+	default:
+		return nil, 0, ErrParams
+	}
+
+	if len(data) < n+1 || len(data) < n+1+int(data[n]) {
+		return nil, 0, ErrParams
+	}
+	params.Salt = append([]byte(nil), data[n+1:n+1+int(data[n])]...)
+	n += 1 + int(data[n])
+
+	if err := params.check(); err != nil {
+		return nil, 0, err
+	}
+	return params, n, nil
+}
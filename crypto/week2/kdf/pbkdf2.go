@@ -0,0 +1,44 @@
+// Package kdf derives keys from passphrases with PBKDF2 (RFC 8018) and
+// scrypt (RFC 7914), and stores the salt and costs they were run with in
+// a short header, so the same keys can be derived again to decrypt.
+package kdf
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+)
+
+// PBKDF2 returns keyLen bytes derived from password and salt with iter
+// iterations of HMAC with h, as PBKDF2 of RFC 8018 section 5.2.
+func PBKDF2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	dk := make([]byte, 0, blocks*hashLen)
+	var index [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for i := 1; i <= blocks; i++ {
+		// U_1 = PRF(P, S || INT(i)), T_i = U_1 xor ... xor U_c
+		binary.BigEndian.PutUint32(index[:], uint32(i))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(index[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		dk = append(dk, t...)
+	}
+
+	return dk[:keyLen]
+}
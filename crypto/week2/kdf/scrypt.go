@@ -0,0 +1,143 @@
+package kdf
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Scrypt returns keyLen bytes derived from password and salt with the
+// scrypt cost parameters: N, a power of two, is the CPU and memory cost,
+// r the block size and p the parallelization. It takes 128*r*N bytes of
+// memory and about 4*N*r*p Salsa20/8 cores of time.
+func Scrypt(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if err := checkScrypt(N, r, p); err != nil {
+		return nil, err
+	}
+
+	b := PBKDF2(password, salt, 1, p*128*r, sha256.New)
+
+	x := make([]uint32, 32*r)
+	v := make([]uint32, 32*r*N)
+	y := make([]uint32, 32*r)
+	for i := 0; i < p; i++ {
+		block := b[i*128*r : (i+1)*128*r]
+		for k := range x {
+			x[k] = binary.LittleEndian.Uint32(block[4*k:])
+		}
+		roMix(x, v, y, r, N)
+		for k := range x {
+			binary.LittleEndian.PutUint32(block[4*k:], x[k])
+		}
+	}
+
+	return PBKDF2(password, b, 1, keyLen, sha256.New), nil
+}
+
+func checkScrypt(N, r, p int) error {
+	if N <= 1 || N&(N-1) != 0 {
+		return errors.New("kdf: scrypt N must be a power of two greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 {
+		return errors.New("kdf: scrypt r and p must be positive with r*p < 2^30")
+	}
+	// RFC 7914 section 2 wants N < 2^(128*r/8); the buffers have to fit
+	// into an int as well.
+	if r < 4 && uint(bits.Len(uint(N))) > uint(16*r) {
+		return errors.New("kdf: scrypt N too large for r")
+	}
+	if uint64(N) > uint64(maxInt/128/r) || uint64(p) > uint64(maxInt/128/r) {
+		return errors.New("kdf: scrypt parameters too large")
+	}
+
+	return nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// roMix is scryptROMix of RFC 7914 section 5 on x, with v holding the N
+// earlier values of x and y as scratch space.
+func roMix(x, v, y []uint32, r, N int) {
+	n := 32 * r
+	for i := 0; i < N; i++ {
+		copy(v[i*n:], x)
+		blockMix(x, y, r)
+	}
+	for i := 0; i < N; i++ {
+		j := int(integerify(x, r) & uint64(N-1))
+		for k := range x {
+			x[k] ^= v[j*n+k]
+		}
+		blockMix(x, y, r)
+	}
+}
+
+// integerify returns the first 64 bits of the last 64-byte block of x.
+func integerify(x []uint32, r int) uint64 {
+	last := (2*r - 1) * 16
+	return uint64(x[last]) | uint64(x[last+1])<<32
+}
+
+// blockMix is scryptBlockMix of RFC 7914 section 4 on b, the 2r 64-byte
+// blocks as words, with y as scratch space.
+func blockMix(b, y []uint32, r int) {
+	var t [16]uint32
+	copy(t[:], b[(2*r-1)*16:])
+
+	for i := 0; i < 2*r; i++ {
+		for k := range t {
+			t[k] ^= b[i*16+k]
+		}
+		salsa208(&t)
+		// even blocks go to the first half, odd ones to the second
+		copy(y[(i/2+(i%2)*r)*16:], t[:])
+	}
+	copy(b, y)
+}
+
+// salsa208 is the Salsa20/8 core of RFC 7914 section 3.
+func salsa208(b *[16]uint32) {
+	x := *b
+	for i := 0; i < 8; i += 2 {
+		// columns
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		// rows
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+
+	for k := range b {
+		b[k] += x[k]
+	}
+}
@@ -0,0 +1,236 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// wideBlock is a 32-byte block cipher for trying the modes on blocks wider
+// than AES: a four round Feistel network whose round function is AES under
+// four keys derived from the key. It is only a test vehicle.
+type wideBlock struct {
+	rounds [4]cipher.Block
+}
+
+const wideBlockSize = 2 * aes.BlockSize
+
+func newWideBlock(key []byte) (cipher.Block, error) {
+	master, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wideBlock{}
+	for r := range w.rounds {
+		roundKey := make([]byte, aes.BlockSize)
+		roundKey[0] = byte(r)
+		master.Encrypt(roundKey, roundKey)
+		if w.rounds[r], err = aes.NewCipher(roundKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func (w *wideBlock) BlockSize() int {
+	return wideBlockSize
+}
+
+func (w *wideBlock) Encrypt(dst, src []byte) {
+	l := append([]byte(nil), src[:aes.BlockSize]...)
+	r := append([]byte(nil), src[aes.BlockSize:wideBlockSize]...)
+	f := make([]byte, aes.BlockSize)
+	for _, b := range w.rounds {
+		b.Encrypt(f, r)
+		for k := range l {
+			l[k] ^= f[k]
+		}
+		l, r = r, l
+	}
+	copy(dst, l)
+	copy(dst[aes.BlockSize:], r)
+}
+
+func (w *wideBlock) Decrypt(dst, src []byte) {
+	l := append([]byte(nil), src[:aes.BlockSize]...)
+	r := append([]byte(nil), src[aes.BlockSize:wideBlockSize]...)
+	f := make([]byte, aes.BlockSize)
+	for k := len(w.rounds) - 1; k >= 0; k-- {
+		l, r = r, l
+		w.rounds[k].Encrypt(f, r)
+		for i := range l {
+			l[i] ^= f[i]
+		}
+	}
+	copy(dst, l)
+	copy(dst[aes.BlockSize:], r)
+}
+
+type newBlock func(key []byte) (cipher.Block, error)
+
+// blockCiphers are the ciphers the modes are run with, from 8 to 32 byte
+// blocks.
+var blockCiphers = []struct {
+	name    string
+	keySize int
+	new     newBlock
+}{
+	{"DES", 8, des.NewCipher},
+	{"3DES", 24, des.NewTripleDESCipher},
+	{"AES-128", 16, aes.NewCipher},
+	{"wide 32-byte", 16, newWideBlock},
+}
+
+// desCBCVectors are the CBC example of FIPS 81 appendix C and a
+// three-key 3DES CBC one made with openssl enc -des-ede3-cbc -nopad.
+var desCBCVectors = []struct {
+	name       string
+	key        string
+	iv         string
+	plaintext  string
+	ciphertext string
+}{
+	{"DES", "0123456789abcdef", "1234567890abcdef", "Now is the time for all ", "e5c7cdde872bf27c43e934008c389c0f683788499a7c05f6"},
+	{"3DES", "0123456789abcdef23456789abcdef01456789abcdef0123", "1234567890abcdef", "Now is the time for all ", "f3c0ff026c023089656fbb169def7edb30ba36075d6f0176"},
+}
+
+func TestDESVectors(t *testing.T) {
+	for _, v := range desCBCVectors {
+		var block cipher.Block
+		var err error
+		if len(v.key) == 16 {
+			block, err = des.NewCipher(testutil.Unhex(v.key))
+		} else {
+			block, err = des.NewTripleDESCipher(testutil.Unhex(v.key))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, pt, want := testutil.Unhex(v.iv), []byte(v.plaintext), testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		modes.NewMyCBCEncrypter(block, iv).CryptBlocks(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+		modes.NewMyCBCDecrypter(block, iv).CryptBlocks(got, want)
+		if !bytes.Equal(got, pt) {
+			t.Fatalf("%s: decrypt got %q, want %q", v.name, got, pt)
+		}
+	}
+}
+
+// TestBlockSizes runs CBC, CTR, the paddings, the streams and ciphertext
+// stealing with every cipher of blockCiphers against crypto/cipher or as
+// round trips.
+func TestBlockSizes(t *testing.T) {
+	for _, c := range blockCiphers {
+		key := make([]byte, c.keySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		block, err := c.new(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs := block.BlockSize()
+		iv := make([]byte, bs)
+		msg := make([]byte, 40*bs+bs/2+1)
+		for _, b := range [][]byte{iv, msg} {
+			if _, err := rand.Read(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		aligned := msg[:len(msg)-len(msg)%bs]
+		want := make([]byte, len(aligned))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(want, aligned)
+		got := make([]byte, len(aligned))
+		modes.NewMyCBCEncrypter(block, iv).CryptBlocks(got, aligned)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: CBC differs from crypto/cipher", c.name)
+		}
+
+		want = make([]byte, len(msg))
+		cipher.NewCTR(block, iv).XORKeyStream(want, msg)
+		got = make([]byte, len(msg))
+		modes.NewMyCTR(block, iv).XORKeyStream(got, msg)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: CTR differs from crypto/cipher", c.name)
+		}
+		modes.NewMyCTR(block, iv).XORKeyStreamParallel(got, msg, 3)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: parallel CTR differs from crypto/cipher", c.name)
+		}
+
+		for _, p := range paddings {
+			enc := modes.NewMyCBCEncrypterWithPadding(block, iv, p.padding)
+			for _, n := range []int{0, 1, bs - 1, bs, bs + 1, len(msg)} {
+				// zero padding can't give back trailing zeros
+				m := bytes.TrimRight(msg[:n], "\x00")
+				wire := enc.Encrypt(make([]byte, enc.EncryptedSize(len(m))), m)
+				dec := modes.NewMyCBCDecrypterWithPadding(block, iv, p.padding)
+				plain, err := dec.Decrypt(make([]byte, len(wire)), wire)
+				if err != nil {
+					t.Fatalf("%s %s: %d bytes: Decrypt failed with: %v", c.name, p.name, len(m), err)
+				}
+				if !bytes.Equal(plain, m) {
+					t.Fatalf("%s %s: %d bytes don't round trip", c.name, p.name, len(m))
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		w := modes.NewCBCEncryptWriter(&buf, block, iv)
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		plain, err := ioutil.ReadAll(modes.NewCBCDecryptReader(&buf, block))
+		if err != nil {
+			t.Fatalf("%s: CBC stream failed with: %v", c.name, err)
+		}
+		if !bytes.Equal(plain, msg) {
+			t.Fatalf("%s: CBC stream doesn't round trip", c.name)
+		}
+
+		buf.Reset()
+		w = modes.NewCTRWriter(&buf, block, iv)
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		plain, err = ioutil.ReadAll(modes.NewCTRReader(&buf, block))
+		if err != nil {
+			t.Fatalf("%s: CTR stream failed with: %v", c.name, err)
+		}
+		if !bytes.Equal(plain, msg) {
+			t.Fatalf("%s: CTR stream doesn't round trip", c.name)
+		}
+
+		cs := modes.NewMyCBCCS(block, iv, modes.CS3)
+		got = make([]byte, len(msg))
+		if err := cs.Encrypt(got, msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := cs.Decrypt(got, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("%s: CBC-CS3 doesn't round trip", c.name)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+type MyCBCEncrypter struct {
+	iv      []byte
+	block   cipher.Block
+	padding Padding
+	// chain holds the previous ciphertext block, starting from iv.
+	chain []byte
+	tmp   []byte
+}
+
+// BlockSize returns the mode's block size.
+func (enc *MyCBCEncrypter) BlockSize() int {
+	return enc.block.BlockSize()
+}
+
+// EncryptedSize returns how long Encrypt's output for srcLen bytes can be.
+// A padding that adds nothing to aligned messages may need a block less.
+func (enc *MyCBCEncrypter) EncryptedSize(srcLen int) int {
+	// source len + iv len + padding len
+	return srcLen + enc.BlockSize() + enc.BlockSize() - srcLen%enc.BlockSize()
+}
+
+// CryptBlocks encrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+// The chaining value is kept between calls, so a message may be encrypted
+// in several pieces.
+func (enc *MyCBCEncrypter) CryptBlocks(dst, src []byte) {
+	blockSize := enc.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		enc.block.Encrypt(dst[i:i+blockSize], xorSlice(enc.tmp, src[i:i+blockSize], enc.chain))
+		copy(enc.chain, dst[i:i+blockSize])
+	}
+}
+
+// Encrypt pads src, encrypts it from the IV the encrypter was created with
+// and writes iv||ciphertext to dst, returning the written part of dst.
+// len(dst) must be at least EncryptedSize(len(src)). The IV must not be
+// used for more than one message.
+func (enc *MyCBCEncrypter) Encrypt(dst, src []byte) []byte {
+	if len(dst) < enc.EncryptedSize(len(src)) {
+		panic("len(dst) < enc.EncryptedSize(len(src))")
+	}
+
+	copy(enc.chain, enc.iv)
+	return encryptPadded(dst, enc.iv, src, enc, enc.padding)
+}
+
+func NewMyCBCEncrypter(b cipher.Block, iv []byte) *MyCBCEncrypter {
+	return NewMyCBCEncrypterWithPadding(b, iv, PKCS7Padding)
+}
+
+// NewMyCBCEncrypterWithPadding returns a MyCBCEncrypter whose Encrypt uses
+// the given padding instead of PKCS#7.
+func NewMyCBCEncrypterWithPadding(b cipher.Block, iv []byte, padding Padding) *MyCBCEncrypter {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	return &MyCBCEncrypter{
+		iv:      dup(iv),
+		block:   b,
+		padding: padding,
+		chain:   dup(iv),
+		tmp:     make([]byte, b.BlockSize()),
+	}
+}
+
+type MyCBCDecrypter struct {
+	block   cipher.Block
+	padding Padding
+	// chain holds the previous ciphertext block, starting from iv.
+	chain []byte
+	next  []byte
+	tmp   []byte
+}
+
+// BlockSize returns the mode's block size.
+func (dec *MyCBCDecrypter) BlockSize() int {
+	return dec.block.BlockSize()
+}
+
+// CryptBlocks decrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+func (dec *MyCBCDecrypter) CryptBlocks(dst, src []byte) {
+	blockSize := dec.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		// keep the ciphertext block, dst may overwrite it
+		copy(dec.next, src[i:i+blockSize])
+		dec.block.Decrypt(dec.tmp, dec.next)
+		xorSlice(dst[i:i+blockSize], dec.tmp, dec.chain)
+		dec.chain, dec.next = dec.next, dec.chain
+	}
+}
+
+// Decrypt decrypts iv||ciphertext as written by MyCBCEncrypter.Encrypt,
+// taking the IV from the first block of src, and returns the plaintext
+// with the padding removed. len(dst) must be at least len(src).
+// It returns ErrShortCiphertext if src is not a whole number of blocks
+// long enough for the padding and ErrInvalidPadding if the padding does
+// not check out.
+func (dec *MyCBCDecrypter) Decrypt(dst, src []byte) ([]byte, error) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	blockSize := dec.BlockSize()
+	if len(src) < blockSize {
+		return nil, ErrShortCiphertext
+	}
+
+	copy(dec.chain, src[:blockSize])
+	return decryptPadded(dst, src[blockSize:], dec, dec.padding)
+}
+
+func NewMyCBCDecrypter(b cipher.Block, iv []byte) *MyCBCDecrypter {
+	return NewMyCBCDecrypterWithPadding(b, iv, PKCS7Padding)
+}
+
+// NewMyCBCDecrypterWithPadding returns a MyCBCDecrypter whose Decrypt
+// expects the given padding instead of PKCS#7.
+func NewMyCBCDecrypterWithPadding(b cipher.Block, iv []byte, padding Padding) *MyCBCDecrypter {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	return &MyCBCDecrypter{
+		block:   b,
+		padding: padding,
+		chain:   dup(iv),
+		next:    make([]byte, b.BlockSize()),
+		tmp:     make([]byte, b.BlockSize()),
+	}
+}
@@ -0,0 +1,142 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var cbcVectors = []sp80038aVector{
+	{"F.2.1 CBC-AES128", 0, sp80038aCBCIV, "7649abac8119b246cee98e9b12e9197d 5086cb9b507219ee95db113a917678b2 73bed6b8e3c1743b7116e69e22229516 3ff1caa1681fac09120eca307586e1a7"},
+	{"F.2.3 CBC-AES192", 1, sp80038aCBCIV, "4f021db243bc633d7178183a9fa071e8 b4d9ada9ad7dedf4e5e738763f69145a 571b242012fb7ae07fa9baac3df102e0 08b0e27988598881d920a9e64f5615cd"},
+	{"F.2.5 CBC-AES256", 2, sp80038aCBCIV, "f58c4c04d6e5f1ba779eabfb5f7bfbd6 9cfc4e967edb808d679f777bc6702c7d 39f23369a9d9bacfa530e26304231461 b2eb05e2c39be9fcda6c19078c6a9d1b"},
+}
+
+func TestSP80038ACBC(t *testing.T) {
+	pt := testutil.Unhex(sp80038aPlaintext)
+	for _, v := range cbcVectors {
+		block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[v.key]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, want := testutil.Unhex(v.iv), testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		modes.NewMyCBCEncrypter(block, iv).CryptBlocks(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+
+		modes.NewMyCBCDecrypter(block, iv).CryptBlocks(got, want)
+		if !bytes.Equal(got, pt) {
+			t.Errorf("%s: decrypt got %x, want %x", v.name, got, pt)
+		}
+
+		// the wire format is the IV followed by the ciphertext, with a
+		// whole block of padding after a block aligned message
+		enc := modes.NewMyCBCEncrypter(block, iv)
+		wire := enc.Encrypt(make([]byte, enc.EncryptedSize(len(pt))), pt)
+		if !bytes.Equal(wire[:len(iv)], iv) || !bytes.Equal(wire[len(iv):len(iv)+len(want)], want) {
+			t.Errorf("%s: Encrypt got %x", v.name, wire)
+		}
+		plain, err := modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(wire)), wire)
+		if err != nil {
+			t.Errorf("%s: Decrypt failed with: %v", v.name, err)
+		} else if !bytes.Equal(plain, pt) {
+			t.Errorf("%s: Decrypt got %x, want %x", v.name, plain, pt)
+		}
+	}
+}
+
+// FuzzCBC compares MyCBCEncrypter and MyCBCDecrypter with crypto/cipher,
+// feeding the message in the pieces cuts cuts it into.
+func FuzzCBC(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, key, iv, msg, cuts []byte) {
+		block, err := aes.NewCipher(key)
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Skip()
+		}
+		pieces := fuzzPieces(len(msg)-len(msg)%aes.BlockSize, aes.BlockSize, cuts)
+		aligned := msg[:len(msg)-len(msg)%aes.BlockSize]
+
+		want := make([]byte, len(aligned))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(want, aligned)
+
+		got := make([]byte, len(aligned))
+		feed(modes.NewMyCBCEncrypter(block, iv).CryptBlocks, got, aligned, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("encrypt of %d bytes in %v differs", len(aligned), pieces)
+		}
+
+		feed(modes.NewMyCBCDecrypter(block, iv).CryptBlocks, got, want, pieces)
+		if !bytes.Equal(got, aligned) {
+			t.Fatalf("decrypt of %d bytes in %v differs", len(aligned), pieces)
+		}
+
+		// Encrypt must be crypto/cipher over the PKCS#7 padded message
+		padded := modes.PKCS7Padding.Pad(append([]byte(nil), msg...), aes.BlockSize)
+		wantWire := append(append([]byte(nil), iv...), make([]byte, len(padded))...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(wantWire[aes.BlockSize:], padded)
+		enc := modes.NewMyCBCEncrypter(block, iv)
+		wire := enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg)
+		if !bytes.Equal(wire, wantWire) {
+			t.Fatalf("Encrypt of %d bytes differs", len(msg))
+		}
+
+		plain, err := modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(wire)), wire)
+		if err != nil || !bytes.Equal(plain, msg) {
+			t.Fatalf("Decrypt of %d bytes got %v", len(msg), err)
+		}
+	})
+}
+
+// TestCBCDecryptErrors feeds Decrypt truncated ciphertexts and bad padding,
+// which must come back as errors rather than panics.
+func TestCBCDecryptErrors(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCBCIV)
+
+	// encrypted returns iv||ciphertext for a plaintext of whole blocks,
+	// without adding any padding
+	encrypted := func(plaintext string) []byte {
+		pt := testutil.Unhex(plaintext)
+		wire := append(append([]byte(nil), iv...), make([]byte, len(pt))...)
+		modes.NewMyCBCEncrypter(block, iv).CryptBlocks(wire[aes.BlockSize:], pt)
+		return wire
+	}
+
+	tests := []struct {
+		name string
+		src  []byte
+		want error
+	}{
+		{"empty", nil, modes.ErrShortCiphertext},
+		{"15 bytes", make([]byte, 15), modes.ErrShortCiphertext},
+		{"IV only", make([]byte, 16), modes.ErrShortCiphertext},
+		{"33 bytes", make([]byte, 33), modes.ErrShortCiphertext},
+		{"padding byte 0", encrypted("000102030405060708090a0b0c0d0e00"), modes.ErrInvalidPadding},
+		{"padding byte 17", encrypted("000102030405060708090a0b0c0d0e11"), modes.ErrInvalidPadding},
+		{"mismatched padding bytes", encrypted("00010203040506070809060606050606"), modes.ErrInvalidPadding},
+		{"bad padding after a good block", encrypted("0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f 000102030405060708090a0b0c0d0eff"), modes.ErrInvalidPadding},
+	}
+	for _, tt := range tests {
+		plain, err := modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(tt.src)), tt.src)
+		if err != tt.want {
+			t.Errorf("%s: Decrypt got %x, %v, want %v", tt.name, plain, err, tt.want)
+		}
+	}
+
+	// the same padding with a length that fits decrypts
+	plain, err := modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, 32), encrypted("00010203040506070809060606060606"))
+	if err != nil || !bytes.Equal(plain, testutil.Unhex("00010203040506070809")) {
+		t.Errorf("good padding: Decrypt got %x, %v", plain, err)
+	}
+}
@@ -0,0 +1,138 @@
+package modes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/sliceutil"
+)
+
+// cbcHMAC is the encrypt-then-MAC AEAD of draft-mcgrew-aead-aes-cbc-hmac-sha2:
+// the MyCBCEncrypter output IV||ciphertext followed by a truncated HMAC
+// over the additional data, IV||ciphertext and the additional data length.
+type cbcHMAC struct {
+	block   cipher.Block
+	macKey  []byte
+	hash    func() hash.Hash
+	tagSize int
+}
+
+// NewAES128CBCHMACSHA256 returns AEAD_AES_128_CBC_HMAC_SHA_256. The 32-byte
+// key is the HMAC key followed by the AES key.
+func NewAES128CBCHMACSHA256(key []byte) (cipher.AEAD, error) {
+	return newCBCHMAC(key, 16, 16, sha256.New, 16)
+}
+
+// NewAES192CBCHMACSHA384 returns AEAD_AES_192_CBC_HMAC_SHA_384 with a
+// 48-byte key.
+func NewAES192CBCHMACSHA384(key []byte) (cipher.AEAD, error) {
+	return newCBCHMAC(key, 24, 24, sha512.New384, 24)
+}
+
+// NewAES256CBCHMACSHA384 returns AEAD_AES_256_CBC_HMAC_SHA_384 with a
+// 56-byte key.
+func NewAES256CBCHMACSHA384(key []byte) (cipher.AEAD, error) {
+	return newCBCHMAC(key, 24, 32, sha512.New384, 24)
+}
+
+// NewAES256CBCHMACSHA512 returns AEAD_AES_256_CBC_HMAC_SHA_512 with a
+// 64-byte key.
+func NewAES256CBCHMACSHA512(key []byte) (cipher.AEAD, error) {
+	return newCBCHMAC(key, 32, 32, sha512.New, 32)
+}
+
+func newCBCHMAC(key []byte, macKeySize, encKeySize int, h func() hash.Hash, tagSize int) (cipher.AEAD, error) {
+	if len(key) != macKeySize+encKeySize {
+		return nil, errors.New("modes: invalid CBC-HMAC key size")
+	}
+
+	block, err := aes.NewCipher(key[macKeySize:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &cbcHMAC{
+		block:   block,
+		macKey:  dup(key[:macKeySize]),
+		hash:    h,
+		tagSize: tagSize,
+	}, nil
+}
+
+// NonceSize returns the IV size. The nonce is used as the CBC IV, so it
+// must be random and is sent as the first block of the sealed message.
+func (c *cbcHMAC) NonceSize() int {
+	return c.block.BlockSize()
+}
+
+// Overhead returns the IV, worst case padding and tag sizes.
+func (c *cbcHMAC) Overhead() int {
+	return 2*c.block.BlockSize() + c.tagSize
+}
+
+func (c *cbcHMAC) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	enc := NewMyCBCEncrypter(c.block, nonce)
+	if enc == nil {
+		panic("modes: incorrect nonce length given to CBC-HMAC")
+	}
+
+	n := enc.EncryptedSize(len(plaintext))
+	ret, out := sliceutil.ForAppend(dst, n+c.tagSize)
+	// Encrypt writes the IV before it reads plaintext, so an in-place
+	// Seal(plaintext[:0], ...) would encrypt the IV instead; go through a
+	// buffer of its own.
+	copy(out, enc.Encrypt(make([]byte, n), plaintext))
+	copy(out[n:], c.tag(out[:n], additionalData))
+
+	return ret
+}
+
+// Open checks the tag before anything is decrypted, so a bad message never
+// reaches the padding check.
+func (c *cbcHMAC) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	blockSize := c.block.BlockSize()
+	if len(nonce) != blockSize {
+		panic("modes: incorrect nonce length given to CBC-HMAC")
+	}
+
+	n := len(ciphertext) - c.tagSize
+	if n < 2*blockSize || n%blockSize != 0 {
+		return nil, errOpen
+	}
+
+	tag := c.tag(ciphertext[:n], additionalData)
+	good := subtle.ConstantTimeCompare(tag, ciphertext[n:])
+	good &= subtle.ConstantTimeCompare(nonce, ciphertext[:blockSize])
+	if good != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceutil.ForAppend(dst, n)
+	plain, err := NewMyCBCDecrypter(c.block, nonce).Decrypt(out, ciphertext[:n])
+	if err != nil {
+		return nil, errOpen
+	}
+
+	return ret[:len(dst)+len(plain)], nil
+}
+
+// tag computes the truncated HMAC over A || IV||ciphertext || AL, where AL
+// is the bit length of A as a 64-bit big-endian number.
+func (c *cbcHMAC) tag(sealed, additionalData []byte) []byte {
+	var al [8]byte
+	binary.BigEndian.PutUint64(al[:], uint64(len(additionalData))*8)
+
+	mac := hmac.New(c.hash, c.macKey)
+	mac.Write(additionalData)
+	mac.Write(sealed)
+	mac.Write(al[:])
+
+	return mac.Sum(nil)[:c.tagSize]
+}
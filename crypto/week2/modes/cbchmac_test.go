@@ -0,0 +1,103 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var (
+	cbcHMACPlaintext = []byte("A cipher system must not be required to be secret, and it must be able to fall into the hands of the enemy without inconvenience")
+	cbcHMACAAD       = []byte("The second principle of Auguste Kerckhoffs")
+	cbcHMACIV        = "1af38c2dc2b96ffdd86694092341bc04"
+)
+
+// cbcHMACVectors are from draft-mcgrew-aead-aes-cbc-hmac-sha2 section 5,
+// the 128/256, 192/384 and 256/512 ones repeated in RFC 7518 appendix B.
+// The key is 00 01 02 ... up to its size.
+var cbcHMACVectors = []struct {
+	name       string
+	new        func(key []byte) (cipher.AEAD, error)
+	keySize    int
+	ciphertext string
+	tag        string
+}{
+	{
+		"AEAD_AES_128_CBC_HMAC_SHA_256",
+		modes.NewAES128CBCHMACSHA256,
+		32,
+		"c80edfa32ddf39d5ef00c0b468834279a2e46a1b8049f792f76bfe54b903a9c9a94ac9b47ad2655c5f10f9aef71427e2fc6f9b3f399a221489f16362c703233609d45ac69864e3321cf82935ac4096c86e133314c54019e8ca7980dfa4b9cf1b384c486f3a54c51078158ee5d79de59fbd34d848b3d69550a67646344427ade54b8851ffb598f7f80074b9473c82e2db",
+		"652c3fa36b0a7c5b3219fab3a30bc1c4",
+	},
+	{
+		"AEAD_AES_192_CBC_HMAC_SHA_384",
+		modes.NewAES192CBCHMACSHA384,
+		48,
+		"ea65da6b59e61edb419be62d19712ae5d303eeb50052d0dfd6697f77224c8edb000d279bdc14c1072654bd30944230c657bed4ca0c9f4a8466f22b226d1746214bf8cfc2400add9f5126e479663fc90b3bed787a2f0ffcbf3904be2a641d5c2105bfe591bae23b1d7449e532eef60a9ac8bb6c6b01d35d49787bcd57ef484927f280adc91ac0c4e79c7b11efc60054e3",
+		"8490ac0e58949bfe51875d733f93ac2075168039ccc733d7",
+	},
+	{
+		"AEAD_AES_256_CBC_HMAC_SHA_384",
+		modes.NewAES256CBCHMACSHA384,
+		56,
+		"893129b0f4ee9eb18d75eda6f2aaa9f3607c98c4ba0444d34162170d8961884e58f27d4a35a5e3e3234aa99404f327f5c2d78e986e5749858b88bcddc2ba05218f195112d6ad48fa3b1e89aa7f20d596682f10b3648d3bb0c983c3185f59e36d28f647c1c13988de8ea0d821198c150977e28ca768080bc78c35faed69d8c0b7d9f506232198a489a1a6ae03a319fb30",
+		"dd131d05ab3467dd056f8e882bad70637f1e9a541d9c23e7",
+	},
+	{
+		"AEAD_AES_256_CBC_HMAC_SHA_512",
+		modes.NewAES256CBCHMACSHA512,
+		64,
+		"4affaaadb78c31c5da4b1b590d10ffbd3dd8d5d302423526912da037ecbcc7bd822c301dd67c373bccb584ad3e9279c2e6d12a1374b77f077553df829410446b36ebd97066296ae6427ea75c2e0846a11a09ccf5370dc80bfecbad28c73f09b3a3b75e662a2594410ae496b2e2e6609e31e6e02cc837f053d21f37ff4f51950bbe2638d09dd7a4930930806d0703b1f6",
+		"4dd3b4c088a7f45c216839645b2012bf2e6269a8c56a816dbc1b267761955bc5",
+	},
+}
+
+func TestCBCHMACVectors(t *testing.T) {
+	for _, v := range cbcHMACVectors {
+		key := make([]byte, v.keySize)
+		for i := range key {
+			key[i] = byte(i)
+		}
+		aead, err := v.new(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		iv := testutil.Unhex(cbcHMACIV)
+		want := append(append(testutil.Unhex(cbcHMACIV), testutil.Unhex(v.ciphertext)...), testutil.Unhex(v.tag)...)
+		got := aead.Seal(nil, iv, cbcHMACPlaintext, cbcHMACAAD)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: Seal got %x, want %x", v.name, got, want)
+		}
+
+		plain, err := aead.Open(nil, iv, want, cbcHMACAAD)
+		if err != nil || !bytes.Equal(plain, cbcHMACPlaintext) {
+			t.Fatalf("%s: Open failed: %v", v.name, err)
+		}
+
+		// in place, as cipher.AEAD allows: Seal(pt[:0], ...) with room
+		// for the overhead and Open(ct[:0], ...)
+		buf := make([]byte, len(cbcHMACPlaintext), len(want))
+		copy(buf, cbcHMACPlaintext)
+		if sealed := aead.Seal(buf[:0], iv, buf, cbcHMACAAD); !bytes.Equal(sealed, want) {
+			t.Fatalf("%s: Seal in place got %x, want %x", v.name, sealed, want)
+		}
+		buf = buf[:len(want)]
+		if plain, err := aead.Open(buf[:0], iv, buf, cbcHMACAAD); err != nil || !bytes.Equal(plain, cbcHMACPlaintext) {
+			t.Fatalf("%s: Open in place got %q, %v", v.name, plain, err)
+		}
+
+		// flipping a bit of the last block would break the padding; the
+		// tag has to catch it before the padding is looked at
+		want[len(want)-len(testutil.Unhex(v.tag))-1] ^= 1
+		if _, err := aead.Open(nil, iv, want, cbcHMACAAD); err == nil {
+			t.Fatalf("%s: Open accepted a forged message", v.name)
+		}
+		if _, err := aead.Open(nil, iv, got, []byte("other data")); err == nil {
+			t.Fatalf("%s: Open accepted the wrong additional data", v.name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// MyCFB is cipher feedback mode (SP 800-38A 6.3) with a segment of one
+// byte up to a whole block: the key stream for a segment is the
+// encryption of the last block size bytes of ciphertext, starting from
+// the IV. With whole-block segments it is the CFB of crypto/cipher, with
+// one-byte segments CFB-8.
+type MyCFB struct {
+	iv      []byte
+	block   cipher.Block
+	segment int
+	decrypt bool
+	// reg is the shift register that is encrypted for the key stream of
+	// a segment, out that key stream and used how much of it is consumed.
+	reg  []byte
+	out  []byte
+	used int
+	// last collects the ciphertext of the current segment.
+	last []byte
+}
+
+// BlockSize returns the block size of the cipher.
+func (x *MyCFB) BlockSize() int {
+	return x.block.BlockSize()
+}
+
+// EncryptedSize returns the length of Encrypt's output for srcLen bytes.
+func (x *MyCFB) EncryptedSize(srcLen int) int {
+	// source len + iv len
+	return srcLen + x.block.BlockSize()
+}
+
+// XORKeyStream encrypts or decrypts src into dst, depending on how the
+// MyCFB was created. Dst and src may point to the same memory. The state
+// is kept between calls, so a message may be processed in pieces of any
+// length.
+func (x *MyCFB) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	x.crypt(dst, src, x.decrypt)
+}
+
+func (x *MyCFB) crypt(dst, src []byte, decrypt bool) {
+	blockSize := x.block.BlockSize()
+	for len(src) > 0 {
+		if x.used == 0 {
+			x.block.Encrypt(x.out, x.reg)
+		}
+
+		n := x.segment - x.used
+		if n > len(src) {
+			n = len(src)
+		}
+		if decrypt {
+			// keep the ciphertext, dst may overwrite it
+			copy(x.last[x.used:], src[:n])
+			xorSlice(dst[:n], src[:n], x.out[x.used:])
+		} else {
+			xorSlice(dst[:n], src[:n], x.out[x.used:])
+			copy(x.last[x.used:], dst[:n])
+		}
+		x.used += n
+		dst = dst[n:]
+		src = src[n:]
+
+		if x.used == x.segment {
+			// shift the segment's ciphertext into the register
+			copy(x.reg, x.reg[x.segment:])
+			copy(x.reg[blockSize-x.segment:], x.last)
+			x.used = 0
+		}
+	}
+}
+
+func (x *MyCFB) reset(iv []byte) {
+	copy(x.reg, iv)
+	x.used = 0
+}
+
+// Encrypt encrypts src from the IV the MyCFB was created with and writes
+// iv||ciphertext to dst, returning the written part of dst.
+// len(dst) must be at least EncryptedSize(len(src)). The IV must not be
+// used for more than one message.
+func (x *MyCFB) Encrypt(dst, src []byte) []byte {
+	n := x.EncryptedSize(len(src))
+	if len(dst) < n {
+		panic("len(dst) < x.EncryptedSize(len(src))")
+	}
+
+	blockSize := x.block.BlockSize()
+	x.reset(x.iv)
+	copy(dst, x.iv)
+	x.crypt(dst[blockSize:n], src, false)
+
+	return dst[:n]
+}
+
+// Decrypt decrypts iv||ciphertext as written by Encrypt, taking the IV
+// from the first block of src. len(dst) must be at least
+// len(src) - BlockSize.
+func (x *MyCFB) Decrypt(dst, src []byte) ([]byte, error) {
+	blockSize := x.block.BlockSize()
+	if len(src) < blockSize {
+		return nil, ErrShortCiphertext
+	}
+
+	n := len(src) - blockSize
+	if len(dst) < n {
+		panic("len(dst) < len(src) - block size")
+	}
+
+	x.reset(src[:blockSize])
+	x.crypt(dst[:n], src[blockSize:], true)
+
+	return dst[:n], nil
+}
+
+// NewMyCFBEncrypter returns a full-block CFB encrypter.
+func NewMyCFBEncrypter(b cipher.Block, iv []byte) *MyCFB {
+	return newMyCFB(b, iv, b.BlockSize(), false)
+}
+
+// NewMyCFBDecrypter returns a full-block CFB decrypter.
+func NewMyCFBDecrypter(b cipher.Block, iv []byte) *MyCFB {
+	return newMyCFB(b, iv, b.BlockSize(), true)
+}
+
+// NewMyCFB8Encrypter returns a CFB-8 encrypter, which runs the block
+// cipher once per byte.
+func NewMyCFB8Encrypter(b cipher.Block, iv []byte) *MyCFB {
+	return newMyCFB(b, iv, 1, false)
+}
+
+// NewMyCFB8Decrypter returns a CFB-8 decrypter.
+func NewMyCFB8Decrypter(b cipher.Block, iv []byte) *MyCFB {
+	return newMyCFB(b, iv, 1, true)
+}
+
+// NewMyCFBWithSegment returns a CFB that works in segments of segmentSize
+// bytes, from 1 to the block size, decrypting if decrypt is set.
+func NewMyCFBWithSegment(b cipher.Block, iv []byte, segmentSize int, decrypt bool) *MyCFB {
+	if segmentSize < 1 || segmentSize > b.BlockSize() {
+		return nil
+	}
+
+	return newMyCFB(b, iv, segmentSize, decrypt)
+}
+
+func newMyCFB(b cipher.Block, iv []byte, segmentSize int, decrypt bool) *MyCFB {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	return &MyCFB{
+		iv:      dup(iv),
+		block:   b,
+		segment: segmentSize,
+		decrypt: decrypt,
+		reg:     dup(iv),
+		out:     make([]byte, b.BlockSize()),
+		last:    make([]byte, segmentSize),
+	}
+}
@@ -0,0 +1,74 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var cfbVectors = []sp80038aVector{
+	{"F.3.13 CFB128-AES128", 0, sp80038aCBCIV, "3b3fd92eb72dad20333449f8e83cfb4a c8a64537a0b3a93fcde3cdad9f1ce58b 26751f67a3cbb140b1808cf187a4f4df c04b05357c5d1c0eeac4c66f9ff7f2e6"},
+	{"F.3.15 CFB128-AES192", 1, sp80038aCBCIV, "cdc80d6fddf18cab34c25909c99a4174 67ce7f7f81173621961a2b70171d3d7a 2e1e8a1dd59b88b1c8e60fed1efac4c9 c05f9f9ca9834fa042ae8fba584b09ff"},
+	{"F.3.17 CFB128-AES256", 2, sp80038aCBCIV, "dc7e84bfda79164b7ecd8486985d3860 39ffed143b28b1c832113c6331e5407b df10132415e54b92a13ed0a8267ae2f9 75a385741ab9cef82031623d55b1e471"},
+}
+
+// cfb8Vectors only cover the first 18 bytes of the plaintext.
+var cfb8Vectors = []sp80038aVector{
+	{"F.3.7 CFB8-AES128", 0, sp80038aCBCIV, "3b79424c9c0dd436bace9e0ed4586a4f32b9"},
+	{"F.3.9 CFB8-AES192", 1, sp80038aCBCIV, "cda2521ef0a905ca44cd057cbf0d47a0678a"},
+	{"F.3.11 CFB8-AES256", 2, sp80038aCBCIV, "dc1f1a8520a64db55fcc8ac554844e889700"},
+}
+
+func TestSP80038ACFB(t *testing.T) {
+	testStreamVectors(t, cfbVectors,
+		func(b cipher.Block, iv []byte) cipher.Stream { return modes.NewMyCFBEncrypter(b, iv) },
+		func(b cipher.Block, iv []byte) cipher.Stream { return modes.NewMyCFBDecrypter(b, iv) })
+	testStreamVectors(t, cfb8Vectors,
+		func(b cipher.Block, iv []byte) cipher.Stream { return modes.NewMyCFB8Encrypter(b, iv) },
+		func(b cipher.Block, iv []byte) cipher.Stream { return modes.NewMyCFB8Decrypter(b, iv) })
+}
+
+// FuzzCFB compares MyCFB with crypto/cipher and CFB-8 with its definition,
+// feeding the message in the pieces cuts cuts it into.
+func FuzzCFB(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, key, iv, msg, cuts []byte) {
+		block, err := aes.NewCipher(key)
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Skip()
+		}
+		pieces := fuzzPieces(len(msg), 1, cuts)
+
+		want := make([]byte, len(msg))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(want, msg)
+
+		got := make([]byte, len(msg))
+		feed(modes.NewMyCFBEncrypter(block, iv).XORKeyStream, got, msg, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("encrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+		feed(modes.NewMyCFBDecrypter(block, iv).XORKeyStream, got, want, pieces)
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("decrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+
+		reg := append([]byte(nil), iv...)
+		out := make([]byte, aes.BlockSize)
+		for k, p := range msg {
+			block.Encrypt(out, reg)
+			want[k] = p ^ out[0]
+			reg = append(reg[1:], want[k])
+		}
+		feed(modes.NewMyCFB8Encrypter(block, iv).XORKeyStream, got, msg, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("CFB-8 encrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+		feed(modes.NewMyCFB8Decrypter(block, iv).XORKeyStream, got, got, pieces)
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("CFB-8 decrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"hash"
+)
+
+var (
+	_ hash.Hash = (*MyCMAC)(nil)
+	_ hash.Hash = (*MyCBCMAC)(nil)
+)
+
+// MyCMAC is CMAC (NIST SP 800-38B, also OMAC1 and RFC 4493 for AES), the
+// CBC-MAC that is safe for messages of any length: the last block is
+// XORed with one of two subkeys before it is encrypted, depending on
+// whether it had to be padded. It runs the message through a
+// MyCBCEncrypter with a zero IV.
+type MyCMAC struct {
+	block  cipher.Block
+	k1, k2 []byte
+	enc    *MyCBCEncrypter
+	// last holds the latest nlast bytes, up to a whole block, which are
+	// held back in case they are the last block.
+	last  []byte
+	nlast int
+	tmp   []byte
+}
+
+// NewMyCMAC returns CMAC over b, whose block size must be 8 or 16 bytes.
+func NewMyCMAC(b cipher.Block) *MyCMAC {
+	blockSize := b.BlockSize()
+	if blockSize != 8 && blockSize != 16 {
+		return nil
+	}
+
+	// the subkeys are L = E(0) doubled once and twice
+	k1 := make([]byte, blockSize)
+	b.Encrypt(k1, k1)
+	k1 = gfDouble(k1)
+
+	return &MyCMAC{
+		block: b,
+		k1:    k1,
+		k2:    gfDouble(k1),
+		enc:   NewMyCBCEncrypter(b, make([]byte, blockSize)),
+		last:  make([]byte, blockSize),
+		tmp:   make([]byte, blockSize),
+	}
+}
+
+// clone returns a MyCMAC with the same keys and no input.
+func (m *MyCMAC) clone() *MyCMAC {
+	blockSize := m.block.BlockSize()
+	return &MyCMAC{
+		block: m.block,
+		k1:    m.k1,
+		k2:    m.k2,
+		enc:   NewMyCBCEncrypter(m.block, make([]byte, blockSize)),
+		last:  make([]byte, blockSize),
+		tmp:   make([]byte, blockSize),
+	}
+}
+
+// Write adds p to the message. It never returns an error.
+func (m *MyCMAC) Write(p []byte) (int, error) {
+	n := len(p)
+	blockSize := len(m.last)
+	for len(p) > 0 {
+		if m.nlast == blockSize {
+			// more is coming, so the held back block is not the last
+			m.enc.CryptBlocks(m.tmp, m.last)
+			m.nlast = 0
+		}
+		if m.nlast == 0 && len(p) > blockSize {
+			m.enc.CryptBlocks(m.tmp, p[:blockSize])
+			p = p[blockSize:]
+			continue
+		}
+
+		k := copy(m.last[m.nlast:], p)
+		m.nlast += k
+		p = p[k:]
+	}
+
+	return n, nil
+}
+
+// Sum appends the tag of the message written so far to in. It does not
+// change the state, so more can be written afterwards.
+func (m *MyCMAC) Sum(in []byte) []byte {
+	blockSize := len(m.last)
+	x := make([]byte, blockSize)
+	copy(x, m.last[:m.nlast])
+	if m.nlast == blockSize {
+		xorSlice(x, x, m.k1)
+	} else {
+		x[m.nlast] = 0x80
+		xorSlice(x, x, m.k2)
+	}
+
+	xorSlice(x, x, m.enc.chain)
+	m.block.Encrypt(x, x)
+
+	return append(in, x...)
+}
+
+// Reset forgets the message written so far.
+func (m *MyCMAC) Reset() {
+	for k := range m.enc.chain {
+		m.enc.chain[k] = 0
+	}
+	m.nlast = 0
+}
+
+// Size returns the tag size, one block.
+func (m *MyCMAC) Size() int {
+	return m.block.BlockSize()
+}
+
+// BlockSize returns the block size of the cipher.
+func (m *MyCMAC) BlockSize() int {
+	return m.block.BlockSize()
+}
+
+// MyCBCMAC is raw CBC-MAC: the last block of CBC encryption with a zero IV,
+// the message being zero padded to a whole number of blocks (ISO/IEC
+// 9797-1 MAC algorithm 1 with padding method 1).
+//
+// It is only secure for messages of one fixed length. Given the tag t of a
+// one-block message m, the tag of the two-block message m || (m XOR t) is
+// t again, since the second block enters the cipher as
+// t XOR m XOR t = m; in general the tags of two messages let anyone forge
+// the tag of their concatenation. Zero padding adds more forgeries, as a
+// message and the same message with trailing zeros share a tag. Use
+// MyCMAC instead.
+type MyCBCMAC struct {
+	block cipher.Block
+	enc   *MyCBCEncrypter
+	// part holds the npart bytes of a partial block, written is whether
+	// anything was written at all.
+	part    []byte
+	npart   int
+	written bool
+	tmp     []byte
+}
+
+// NewMyCBCMAC returns raw CBC-MAC over b.
+func NewMyCBCMAC(b cipher.Block) *MyCBCMAC {
+	blockSize := b.BlockSize()
+	return &MyCBCMAC{
+		block: b,
+		enc:   NewMyCBCEncrypter(b, make([]byte, blockSize)),
+		part:  make([]byte, blockSize),
+		tmp:   make([]byte, blockSize),
+	}
+}
+
+// Write adds p to the message. It never returns an error.
+func (m *MyCBCMAC) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > 0 {
+		m.written = true
+	}
+
+	blockSize := len(m.part)
+	for len(p) > 0 {
+		if m.npart == 0 && len(p) >= blockSize {
+			m.enc.CryptBlocks(m.tmp, p[:blockSize])
+			p = p[blockSize:]
+			continue
+		}
+
+		k := copy(m.part[m.npart:], p)
+		m.npart += k
+		p = p[k:]
+		if m.npart == blockSize {
+			m.enc.CryptBlocks(m.tmp, m.part)
+			m.npart = 0
+		}
+	}
+
+	return n, nil
+}
+
+// Sum appends the tag of the message written so far to in. It does not
+// change the state.
+func (m *MyCBCMAC) Sum(in []byte) []byte {
+	if m.npart == 0 && m.written {
+		return append(in, m.enc.chain...)
+	}
+
+	// zero pad the partial block, or the empty message to one block
+	x := make([]byte, len(m.part))
+	copy(x, m.part[:m.npart])
+	xorSlice(x, x, m.enc.chain)
+	m.block.Encrypt(x, x)
+
+	return append(in, x...)
+}
+
+// Reset forgets the message written so far.
+func (m *MyCBCMAC) Reset() {
+	for k := range m.enc.chain {
+		m.enc.chain[k] = 0
+	}
+	m.npart = 0
+	m.written = false
+}
+
+// Size returns the tag size, one block.
+func (m *MyCBCMAC) Size() int {
+	return m.block.BlockSize()
+}
+
+// BlockSize returns the block size of the cipher.
+func (m *MyCBCMAC) BlockSize() int {
+	return m.block.BlockSize()
+}
+
+// gfDouble returns b multiplied by x in GF(2^64) or GF(2^128), b being a
+// big-endian number: the dbl() of RFC 5297 and the subkey step of SP
+// 800-38B.
+func gfDouble(b []byte) []byte {
+	r := byte(0x87)
+	if len(b) == 8 {
+		r = 0x1b
+	}
+
+	d := make([]byte, len(b))
+	carry := b[0] >> 7
+	for k := 0; k < len(b)-1; k++ {
+		d[k] = b[k]<<1 | b[k+1]>>7
+	}
+	d[len(b)-1] = b[len(b)-1]<<1 ^ r&-carry
+
+	return d
+}
@@ -0,0 +1,122 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// cmacVectors are the examples of NIST SP 800-38B appendix D, the AES-128
+// ones being those of RFC 4493 too. The messages are the first bytes of
+// the SP 800-38A plaintext.
+var cmacVectors = []struct {
+	name   string
+	key    string
+	tdea   bool
+	length int
+	tag    string
+}{
+	{"D.1 AES-128 example 1", "2b7e151628aed2a6abf7158809cf4f3c", false, 0, "bb1d6929e95937287fa37d129b756746"},
+	{"D.1 AES-128 example 2", "2b7e151628aed2a6abf7158809cf4f3c", false, 16, "070a16b46b4d4144f79bdd9dd04a287c"},
+	{"D.1 AES-128 example 3", "2b7e151628aed2a6abf7158809cf4f3c", false, 40, "dfa66747de9ae63030ca32611497c827"},
+	{"D.1 AES-128 example 4", "2b7e151628aed2a6abf7158809cf4f3c", false, 64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	{"D.2 AES-192 example 5", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", false, 0, "d17ddf46adaacde531cac483de7a9367"},
+	{"D.2 AES-192 example 6", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", false, 16, "9e99a7bf31e710900662f65e617c5184"},
+	{"D.2 AES-192 example 7", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", false, 40, "8a1de5be2eb31aad089a82e6ee908b0e"},
+	{"D.2 AES-192 example 8", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", false, 64, "a1d5df0eed790f794d77589659f39a11"},
+	{"D.3 AES-256 example 9", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", false, 0, "028962f61b7bf89efc6b551f4667d983"},
+	{"D.3 AES-256 example 10", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", false, 16, "28a7023f452e8f82bd4bf28d8c37c35c"},
+	{"D.3 AES-256 example 11", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", false, 40, "aaf3d8f1de5640c232f5b169b9c911e6"},
+	{"D.3 AES-256 example 12", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", false, 64, "e1992190549f6ed5696a2c056c315410"},
+	{"D.4 TDEA example 13", "8aa83bf8cbda10620bc1bf19fbb6cd58bc313d4a371ca8b5", true, 0, "b7a688e122ffaf95"},
+	{"D.4 TDEA example 14", "8aa83bf8cbda10620bc1bf19fbb6cd58bc313d4a371ca8b5", true, 8, "8e8f293136283797"},
+	{"D.4 TDEA example 15", "8aa83bf8cbda10620bc1bf19fbb6cd58bc313d4a371ca8b5", true, 20, "743ddbe0ce2dc2ed"},
+	{"D.4 TDEA example 16", "8aa83bf8cbda10620bc1bf19fbb6cd58bc313d4a371ca8b5", true, 32, "33e6b1092400eae5"},
+}
+
+func TestCMACVectors(t *testing.T) {
+	msg := testutil.Unhex(sp80038aPlaintext)
+	for _, v := range cmacVectors {
+		var block cipher.Block
+		var err error
+		if v.tdea {
+			block, err = des.NewTripleDESCipher(testutil.Unhex(v.key))
+		} else {
+			block, err = aes.NewCipher(testutil.Unhex(v.key))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, want := msg[:v.length], testutil.Unhex(v.tag)
+
+		mac := modes.NewMyCMAC(block)
+		mac.Write(m)
+		if got := mac.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %x, want %x", v.name, got, want)
+		}
+
+		// a byte at a time, with Sum in between
+		mac.Reset()
+		for k := range m {
+			mac.Write(m[k : k+1])
+			mac.Sum(nil)
+		}
+		if got := mac.Sum([]byte("x")); !bytes.Equal(got[1:], want) || got[0] != 'x' {
+			t.Fatalf("%s: written bytewise got %x, want %x", v.name, got[1:], want)
+		}
+	}
+}
+
+// TestCBCMAC compares CBC-MAC with the last block of crypto/cipher CBC
+// and carries out the forgery documented on MyCBCMAC.
+func TestCBCMAC(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := testutil.Unhex(sp80038aPlaintext)
+
+	want := make([]byte, len(msg))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(want, msg)
+	mac := modes.NewMyCBCMAC(block)
+	for _, piece := range [][]byte{msg[:5], msg[5:37], msg[37:]} {
+		mac.Write(piece)
+	}
+	if got := mac.Sum(nil); !bytes.Equal(got, want[len(want)-aes.BlockSize:]) {
+		t.Fatalf("CBC-MAC got %x, want %x", got, want[len(want)-aes.BlockSize:])
+	}
+
+	// the forgery: from m and its tag alone, m || (m XOR tag) gets the same tag
+	m := []byte("pay alice $100!!")
+	mac.Reset()
+	mac.Write(m)
+	tag := mac.Sum(nil)
+
+	forged := append([]byte(nil), m...)
+	for k := range m {
+		forged = append(forged, m[k]^tag[k])
+	}
+	mac.Reset()
+	mac.Write(forged)
+	if got := mac.Sum(nil); !bytes.Equal(got, tag) {
+		t.Fatalf("CBC-MAC forgery didn't work, got %x, want %x", got, tag)
+	}
+
+	// the same trick with a CMAC tag doesn't work
+	cmac := modes.NewMyCMAC(block)
+	cmac.Write(m)
+	tag = cmac.Sum(nil)
+	for k := range m {
+		forged[len(m)+k] = m[k] ^ tag[k]
+	}
+	cmac.Reset()
+	cmac.Write(forged)
+	if bytes.Equal(cmac.Sum(nil), tag) {
+		t.Fatalf("CMAC fell for the CBC-MAC forgery")
+	}
+}
@@ -0,0 +1,317 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+	"math"
+)
+
+// DefaultCounterSize is the number of trailing counter block bytes MyCTR
+// increments unless told otherwise; the bytes before them are a fixed
+// nonce. Blocks of DefaultCounterSize bytes or less, like the 8-byte DES
+// blocks, are a counter as a whole.
+const DefaultCounterSize = 8
+
+type MyCTR struct {
+	iv    []byte
+	block cipher.Block
+	// counterSize is the number of trailing bytes of the counter block
+	// that are incremented, the rest is a fixed nonce.
+	counterSize int
+	// ctr is the next counter block to encrypt, out the current key
+	// stream block of which used bytes are already consumed.
+	ctr  []byte
+	out  []byte
+	used int
+	// left is how many counter blocks, ctr included, can still be used
+	// before the counter wraps.
+	left uint64
+	// start is the counter block the current stream began at and pos
+	// the offset of the next key stream byte from it.
+	start []byte
+	pos   int64
+}
+
+func (ctr *MyCTR) EncryptedSize(srcLen int) int {
+	// source len + iv len
+	return srcLen + ctr.block.BlockSize()
+}
+
+// XORKeyStream XORs each byte in the given slice with a byte from the
+// cipher's key stream. Dst and src may point to the same memory.
+// If len(dst) < len(src), XORKeyStream panics. It is acceptable
+// to pass a dst bigger than src, and in that case, XORKeyStream will
+// only update dst[:len(src)] and will not touch the rest of dst.
+// XORKeyStream also panics, before touching dst, if src needs more key
+// stream than is left before the counter wraps; use CheckLength to find
+// out beforehand.
+func (ctr *MyCTR) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+	if err := ctr.CheckLength(len(src)); err != nil {
+		panic(err.Error())
+	}
+
+	for len(src) > 0 {
+		if ctr.used == len(ctr.out) {
+			ctr.block.Encrypt(ctr.out, ctr.ctr)
+			ctr.used = 0
+
+			addCounter(ctr.ctr, ctr.ctr, 1, ctr.counterSize)
+			ctr.left--
+		}
+
+		n := len(ctr.out) - ctr.used
+		if n > len(src) {
+			n = len(src)
+		}
+		xorSlice(dst[:n], src[:n], ctr.out[ctr.used:])
+		ctr.used += n
+		ctr.pos += int64(n)
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+// CheckLength returns ErrCounterOverflow if XORKeyStream can't process n
+// more bytes without the counter wrapping around into key stream that was
+// already used.
+func (ctr *MyCTR) CheckLength(n int) error {
+	buffered := len(ctr.out) - ctr.used
+	if n <= buffered {
+		return nil
+	}
+
+	if blocksFor(uint64(n-buffered), len(ctr.out)) > ctr.left {
+		return ErrCounterOverflow
+	}
+
+	return nil
+}
+
+// XORKeyStreamAt XORs src with the key stream starting at byte offset of
+// the stream that begins at the IV the MyCTR was created with, so any part
+// of a message can be decrypted without processing what comes before it.
+// It does not change the position used by XORKeyStream and is safe for
+// concurrent use. It returns ErrCounterOverflow, without touching dst, if
+// the range runs past the end of the counter space.
+func (ctr *MyCTR) XORKeyStreamAt(dst, src []byte, offset int64) error {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+	if offset < 0 {
+		return errors.New("modes: negative offset")
+	}
+
+	blockSize := int64(ctr.block.BlockSize())
+	end := blocksFor(uint64(offset)+uint64(len(src)), int(blockSize))
+	if end > counterBlocks(ctr.iv, ctr.counterSize) {
+		return ErrCounterOverflow
+	}
+
+	counter := make([]byte, blockSize)
+	addCounter(counter, ctr.iv, uint64(offset/blockSize), ctr.counterSize)
+	ctr.xorBlocks(dst, src, counter, int(offset%blockSize))
+
+	return nil
+}
+
+// xorBlocks XORs src with the key stream that starts skip bytes into the
+// block of counter, advancing counter as it goes. It only touches its
+// arguments, so several calls can run at once.
+func (ctr *MyCTR) xorBlocks(dst, src, counter []byte, skip int) {
+	out := make([]byte, len(counter))
+	for len(src) > 0 {
+		ctr.block.Encrypt(out, counter)
+		addCounter(counter, counter, 1, ctr.counterSize)
+
+		n := len(out) - skip
+		if n > len(src) {
+			n = len(src)
+		}
+		xorSlice(dst[:n], src[:n], out[skip:])
+		dst = dst[n:]
+		src = src[n:]
+		skip = 0
+	}
+}
+
+// Seek moves the position of XORKeyStream to a byte offset of the current
+// stream, which begins at the IV the MyCTR was created with or the one
+// read by Decrypt. whence is io.SeekStart or io.SeekCurrent; the end of a
+// key stream is unknown, so io.SeekEnd is rejected, as is an offset past
+// the end of the counter space.
+func (ctr *MyCTR) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += ctr.pos
+	default:
+		return ctr.pos, errors.New("modes: invalid whence")
+	}
+	if offset < 0 {
+		return ctr.pos, errors.New("modes: negative offset")
+	}
+
+	blockSize := int64(ctr.block.BlockSize())
+	left := counterBlocks(ctr.start, ctr.counterSize)
+	if blocksFor(uint64(offset), int(blockSize)) > left {
+		return ctr.pos, ErrCounterOverflow
+	}
+
+	skipped := uint64(offset / blockSize)
+	addCounter(ctr.ctr, ctr.start, skipped, ctr.counterSize)
+	ctr.left = left - skipped
+	ctr.used = len(ctr.out)
+	if skip := int(offset % blockSize); skip > 0 {
+		ctr.block.Encrypt(ctr.out, ctr.ctr)
+		addCounter(ctr.ctr, ctr.ctr, 1, ctr.counterSize)
+		ctr.left--
+		ctr.used = skip
+	}
+	ctr.pos = offset
+
+	return offset, nil
+}
+
+// reset restarts the key stream at the counter block iv.
+func (ctr *MyCTR) reset(iv []byte) {
+	copy(ctr.start, iv)
+	copy(ctr.ctr, iv)
+	ctr.left = counterBlocks(iv, ctr.counterSize)
+	ctr.used = len(ctr.out)
+	ctr.pos = 0
+}
+
+// Encrypt encrypts src from the IV the stream was created with and writes
+// iv||ciphertext to dst, returning the written part of dst.
+// len(dst) must be at least EncryptedSize(len(src)). The IV must not be
+// used for more than one message.
+func (ctr *MyCTR) Encrypt(dst, src []byte) ([]byte, error) {
+	n := ctr.EncryptedSize(len(src))
+	if len(dst) < n {
+		panic("len(dst) < ctr.EncryptedSize(len(src))")
+	}
+
+	ctr.reset(ctr.iv)
+	if err := ctr.CheckLength(len(src)); err != nil {
+		return nil, err
+	}
+
+	blockSize := ctr.block.BlockSize()
+	copy(dst, ctr.iv)
+	ctr.XORKeyStream(dst[blockSize:n], src)
+
+	return dst[:n], nil
+}
+
+// Decrypt decrypts iv||ciphertext as written by Encrypt, taking the IV
+// from the first block of src. len(dst) must be at least
+// len(src) - BlockSize.
+func (ctr *MyCTR) Decrypt(dst, src []byte) ([]byte, error) {
+	blockSize := ctr.block.BlockSize()
+	if len(src) < blockSize {
+		return nil, ErrShortCiphertext
+	}
+
+	n := len(src) - blockSize
+	if len(dst) < n {
+		panic("len(dst) < len(src) - block size")
+	}
+
+	ctr.reset(src[:blockSize])
+	if err := ctr.CheckLength(n); err != nil {
+		return nil, err
+	}
+	ctr.XORKeyStream(dst[:n], src[blockSize:])
+
+	return dst[:n], nil
+}
+
+// addCounter sets dst to the counter block src advanced by n blocks. Only
+// the last counterSize bytes take part in the addition; a carry out of
+// them is dropped, callers check the counter space beforehand.
+func addCounter(dst, src []byte, n uint64, counterSize int) {
+	copy(dst, src)
+	for k := len(dst) - 1; k >= len(dst)-counterSize && n > 0; k-- {
+		sum := uint64(dst[k]) + n&0xff
+		dst[k] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+}
+
+// counterBlocks returns how many counter blocks, counter included, there
+// are before the last counterSize bytes of counter wrap around, saturating
+// at math.MaxUint64.
+func counterBlocks(counter []byte, counterSize int) uint64 {
+	var rest uint64
+	for k := len(counter) - counterSize; k < len(counter); k++ {
+		if rest > math.MaxUint64>>8 {
+			return math.MaxUint64
+		}
+		rest = rest<<8 | uint64(^counter[k])
+	}
+
+	if rest == math.MaxUint64 {
+		return rest
+	}
+	return rest + 1
+}
+
+// blocksFor returns the number of blockSize blocks that n bytes span.
+func blocksFor(n uint64, blockSize int) uint64 {
+	return (n + uint64(blockSize) - 1) / uint64(blockSize)
+}
+
+func NewMyCTR(block cipher.Block, iv []byte) *MyCTR {
+	return NewMyCTRWithCounter(block, iv, defaultCounterSize(block.BlockSize()))
+}
+
+// defaultCounterSize returns the counter size NewMyCTR uses for blockSize.
+func defaultCounterSize(blockSize int) int {
+	if blockSize < DefaultCounterSize {
+		return blockSize
+	}
+
+	return DefaultCounterSize
+}
+
+// NewMyCTRWithCounter returns a MyCTR that increments the last counterSize
+// bytes of the counter block as a big-endian number and keeps the bytes
+// before them as a nonce, e.g. 4 for a 96-bit nonce and 32-bit counter or
+// the block size for a full-block counter.
+func NewMyCTRWithCounter(block cipher.Block, iv []byte, counterSize int) *MyCTR {
+	if len(iv) != block.BlockSize() || counterSize < 1 || counterSize > len(iv) {
+		return nil
+	}
+
+	ctr := &MyCTR{
+		iv:          dup(iv),
+		block:       block,
+		counterSize: counterSize,
+		ctr:         make([]byte, len(iv)),
+		start:       make([]byte, len(iv)),
+		out:         make([]byte, len(iv)),
+	}
+	ctr.reset(iv)
+
+	return ctr
+}
+
+// NewRFC3686CTR returns the AES-CTR of RFC 3686, whose counter block is
+// the 4-byte nonce, the 8-byte per-packet IV and a 32-bit block counter
+// starting at one.
+func NewRFC3686CTR(block cipher.Block, nonce, iv []byte) *MyCTR {
+	if block.BlockSize() != 16 || len(nonce) != 4 || len(iv) != 8 {
+		return nil
+	}
+
+	counter := make([]byte, 16)
+	copy(counter, nonce)
+	copy(counter[4:], iv)
+	counter[15] = 1
+
+	return NewMyCTRWithCounter(block, counter, 4)
+}
@@ -0,0 +1,298 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var ctrVectors = []sp80038aVector{
+	{"F.5.1 CTR-AES128", 0, sp80038aCTRIV, "874d6191b620e3261bef6864990db6ce 9806f66b7970fdff8617187bb9fffdff 5ae4df3edbd5d35e5b4f09020db03eab 1e031dda2fbe03d1792170a0f3009cee"},
+	{"F.5.3 CTR-AES192", 1, sp80038aCTRIV, "1abc932417521ca24f2b0459fe7e6e0b 090339ec0aa6faefd5ccc2c6f4ce8e94 1e36b26bd1ebc670d1bd1d665620abf7 4f78a7f6d29809585a97daec58c6b050"},
+	{"F.5.5 CTR-AES256", 2, sp80038aCTRIV, "601ec313775789a5b7a7f504bbf3d228 f443e3ca4d62b59aca84e990cacaf5c5 2b0930daa23de94ce87017ba2d84988d dfc9c58db67aada613c2dd08457941a6"},
+}
+
+func TestSP80038ACTR(t *testing.T) {
+	pt := testutil.Unhex(sp80038aPlaintext)
+	for _, v := range ctrVectors {
+		block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[v.key]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, want := testutil.Unhex(v.iv), testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		modes.NewMyCTR(block, iv).XORKeyStream(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+
+		// one byte at a time, the key stream must carry over between calls
+		ctr := modes.NewMyCTR(block, iv)
+		for k := range want {
+			ctr.XORKeyStream(got[k:k+1], want[k:k+1])
+		}
+		if !bytes.Equal(got, pt) {
+			t.Errorf("%s: decrypt got %x, want %x", v.name, got, pt)
+		}
+
+		wire := append(append([]byte(nil), iv...), want...)
+		plain, err := modes.NewMyCTR(block, iv).Decrypt(make([]byte, len(wire)), wire)
+		if err != nil {
+			t.Errorf("%s: Decrypt failed with: %v", v.name, err)
+		} else if !bytes.Equal(plain, pt) {
+			t.Errorf("%s: Decrypt got %x, want %x", v.name, plain, pt)
+		}
+	}
+}
+
+// FuzzCTR compares MyCTR with crypto/cipher, feeding the message in the
+// pieces cuts cuts it into.
+func FuzzCTR(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, key, iv, msg, cuts []byte) {
+		block, err := aes.NewCipher(key)
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Skip()
+		}
+		pieces := fuzzPieces(len(msg), 1, cuts)
+
+		want := make([]byte, len(msg))
+		cipher.NewCTR(block, iv).XORKeyStream(want, msg)
+
+		got := make([]byte, len(msg))
+		feed(modes.NewMyCTR(block, iv).XORKeyStream, got, msg, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("XORKeyStream of %d bytes in %v differs", len(msg), pieces)
+		}
+
+		ctr := modes.NewMyCTR(block, iv)
+		wire, err := ctr.Encrypt(make([]byte, ctr.EncryptedSize(len(msg))), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wire[:aes.BlockSize], iv) || !bytes.Equal(wire[aes.BlockSize:], want) {
+			t.Fatalf("Encrypt of %d bytes differs", len(msg))
+		}
+	})
+}
+
+// ctrKeyStreamCase returns a MyCTR on the first SP 800-38A key and IV with
+// a message and its encryption by crypto/cipher.
+func ctrKeyStreamCase(t *testing.T) (ctr *modes.MyCTR, msg, want []byte) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCTRIV)
+
+	msg = make([]byte, 1000)
+	for k := range msg {
+		msg[k] = byte(k * 7)
+	}
+	want = make([]byte, len(msg))
+	cipher.NewCTR(block, iv).XORKeyStream(want, msg)
+
+	return modes.NewMyCTR(block, iv), msg, want
+}
+
+func TestCTRXORKeyStreamAt(t *testing.T) {
+	ctr, msg, want := ctrKeyStreamCase(t)
+
+	for _, off := range []int{0, 1, 15, 16, 17, 100, 999} {
+		for _, n := range []int{0, 1, 15, 16, 33, len(msg) - off} {
+			if off+n > len(msg) {
+				continue
+			}
+			got := make([]byte, n)
+			if err := ctr.XORKeyStreamAt(got, msg[off:off+n], int64(off)); err != nil {
+				t.Fatalf("offset %d, %d bytes: %v", off, n, err)
+			}
+			if !bytes.Equal(got, want[off:off+n]) {
+				t.Errorf("offset %d, %d bytes: got %x, want %x", off, n, got, want[off:off+n])
+			}
+		}
+	}
+
+	// XORKeyStreamAt leaves the position of XORKeyStream alone
+	got := make([]byte, len(msg))
+	ctr.XORKeyStream(got, msg)
+	if !bytes.Equal(got, want) {
+		t.Errorf("XORKeyStream after XORKeyStreamAt differs")
+	}
+
+	if err := ctr.XORKeyStreamAt(got, msg, -1); err == nil {
+		t.Errorf("negative offset accepted")
+	}
+}
+
+func TestCTRSeek(t *testing.T) {
+	ctr, msg, want := ctrKeyStreamCase(t)
+
+	// check XORs the next n bytes from the current position pos
+	check := func(pos, n int) {
+		t.Helper()
+		got := make([]byte, n)
+		ctr.XORKeyStream(got, msg[pos:pos+n])
+		if !bytes.Equal(got, want[pos:pos+n]) {
+			t.Errorf("%d bytes at %d: got %x, want %x", n, pos, got, want[pos:pos+n])
+		}
+	}
+	seek := func(offset int64, whence int, want int64) {
+		t.Helper()
+		if pos, err := ctr.Seek(offset, whence); err != nil || pos != want {
+			t.Fatalf("Seek(%d, %d) got %d, %v, want %d", offset, whence, pos, err, want)
+		}
+	}
+
+	check(0, 5)
+	seek(37, io.SeekStart, 37)
+	check(37, 20)
+	seek(-30, io.SeekCurrent, 27)
+	check(27, 10)
+	seek(3, io.SeekCurrent, 40)
+	check(40, 1)
+	seek(0, io.SeekCurrent, 41)
+	seek(16, io.SeekStart, 16)
+	check(16, 100)
+
+	if pos, err := ctr.Seek(0, io.SeekEnd); err == nil || pos != 116 {
+		t.Errorf("Seek from the end got %d, %v", pos, err)
+	}
+	if pos, err := ctr.Seek(-117, io.SeekCurrent); err == nil || pos != 116 {
+		t.Errorf("Seek before the start got %d, %v", pos, err)
+	}
+	// a rejected Seek leaves the position where it was
+	check(116, 3)
+}
+
+// rfc3686Vectors are test vectors #1 to #3 of RFC 3686 section 6.
+var rfc3686Vectors = []struct {
+	key, nonce, iv, plaintext, ciphertext string
+}{
+	{
+		"ae6852f8121067cc4bf7a5765577f39e", "00000030", "0000000000000000",
+		"53696e676c6520626c6f636b206d7367",
+		"e4095d4fb7a7b3792d6175a3261311b8",
+	},
+	{
+		"7e24067817fae0d743d6ce1f32539163", "006cb6db", "c0543b59da48d90b",
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"5104a106168a72d9790d41ee8edad388eb2e1efc46da57c8fce630df9141be28",
+	},
+	{
+		"7691be035e5020a8ac6e618529f9a0dc", "00e0017b", "27777f3f4a1786f0",
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20212223",
+		"c1cf48a89f2ffdd9cf4652e9efdb72d74540a42bde6d7836d59a5ceaaef3105325b2072f",
+	},
+}
+
+func TestRFC3686CTR(t *testing.T) {
+	for k, v := range rfc3686Vectors {
+		block, err := aes.NewCipher(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pt, want := testutil.Unhex(v.plaintext), testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		modes.NewRFC3686CTR(block, testutil.Unhex(v.nonce), testutil.Unhex(v.iv)).XORKeyStream(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("vector #%d: got %x, want %x", k+1, got, want)
+		}
+	}
+
+	block, _ := aes.NewCipher(testutil.Unhex(rfc3686Vectors[0].key))
+	if modes.NewRFC3686CTR(block, make([]byte, 3), make([]byte, 8)) != nil || modes.NewRFC3686CTR(block, make([]byte, 4), make([]byte, 16)) != nil {
+		t.Errorf("NewRFC3686CTR accepted a bad nonce or IV size")
+	}
+	for _, counterSize := range []int{0, 17} {
+		if modes.NewMyCTRWithCounter(block, make([]byte, 16), counterSize) != nil {
+			t.Errorf("NewMyCTRWithCounter accepted counter size %d", counterSize)
+		}
+	}
+}
+
+// TestCTRCounterOverflow runs a 32-bit counter two blocks short of wrapping
+// past its end, which must fail with ErrCounterOverflow before any key
+// stream is written.
+func TestCTRCounterOverflow(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex("000102030405060708090a0b fffffffe")
+	newCTR := func() *modes.MyCTR { return modes.NewMyCTRWithCounter(block, iv, 4) }
+
+	msg := make([]byte, 2*aes.BlockSize+1)
+	want := make([]byte, 2*aes.BlockSize)
+	cipher.NewCTR(block, iv).XORKeyStream(want, msg[:len(want)])
+
+	// untouched returns a buffer to write into and reports whether it
+	// still holds what it was filled with
+	untouched := func(n int) ([]byte, func() bool) {
+		buf := bytes.Repeat([]byte{0xa5}, n)
+		return buf, func() bool { return bytes.Equal(buf, bytes.Repeat([]byte{0xa5}, n)) }
+	}
+
+	// the two blocks before the wrap are fine
+	ctr := newCTR()
+	got, err := ctr.Encrypt(make([]byte, ctr.EncryptedSize(len(want))), msg[:len(want)])
+	if err != nil || !bytes.Equal(got[aes.BlockSize:], want) {
+		t.Fatalf("Encrypt of the last two blocks got %x, %v", got, err)
+	}
+	if err := ctr.CheckLength(0); err != nil {
+		t.Errorf("CheckLength(0) at the end got %v", err)
+	}
+	if err := ctr.CheckLength(1); err != modes.ErrCounterOverflow {
+		t.Errorf("CheckLength(1) at the end got %v", err)
+	}
+
+	dst, ok := untouched(newCTR().EncryptedSize(len(msg)))
+	if _, err := newCTR().Encrypt(dst, msg); err != modes.ErrCounterOverflow || !ok() {
+		t.Errorf("Encrypt past the wrap got %v, wrote %t", err, !ok())
+	}
+
+	dst, ok = untouched(len(msg))
+	if err := newCTR().XORKeyStreamAt(dst, msg, 0); err != modes.ErrCounterOverflow || !ok() {
+		t.Errorf("XORKeyStreamAt past the wrap got %v, wrote %t", err, !ok())
+	}
+	dst, ok = untouched(1)
+	if err := newCTR().XORKeyStreamAt(dst, msg[:1], int64(len(want))); err != modes.ErrCounterOverflow || !ok() {
+		t.Errorf("XORKeyStreamAt at the wrap got %v, wrote %t", err, !ok())
+	}
+	dst, ok = untouched(1)
+	if err := newCTR().XORKeyStreamAt(dst, msg[:1], int64(len(want))-1); err != nil || dst[0] != want[len(want)-1] {
+		t.Errorf("XORKeyStreamAt of the last byte got %x, %v", dst, err)
+	}
+
+	ctr = newCTR()
+	if _, err := ctr.Seek(int64(len(want))+1, io.SeekStart); err != modes.ErrCounterOverflow {
+		t.Errorf("Seek past the wrap got %v", err)
+	}
+	if pos, err := ctr.Seek(int64(len(want)), io.SeekStart); err != nil || pos != int64(len(want)) {
+		t.Errorf("Seek to the wrap got %d, %v", pos, err)
+	}
+	if _, err := ctr.Seek(1, io.SeekCurrent); err != modes.ErrCounterOverflow {
+		t.Errorf("Seek on past the wrap got %v", err)
+	}
+
+	// XORKeyStream has no error to return, so it panics instead
+	dst, ok = untouched(1)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("XORKeyStream past the wrap did not panic")
+			}
+		}()
+		ctr.XORKeyStream(dst, msg[:1])
+	}()
+	if !ok() {
+		t.Errorf("XORKeyStream past the wrap wrote key stream")
+	}
+}
@@ -0,0 +1,146 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// CTSVariant selects how CBC ciphertext stealing orders the last two
+// ciphertext blocks, per the NIST SP 800-38A addendum.
+type CTSVariant int
+
+const (
+	// CS1 keeps the blocks in order, with the partial block second to last.
+	CS1 CTSVariant = iota + 1
+	// CS2 swaps the last two blocks only when the last one is partial, so
+	// whole-block messages are plain CBC.
+	CS2
+	// CS3 always swaps the last two blocks, as Kerberos (RFC 3962) does.
+	CS3
+)
+
+// MyCBCCS is CBC with ciphertext stealing: instead of padding, the last
+// partial block borrows the tail of the block before it, so the ciphertext
+// is exactly as long as the plaintext. The IV is not part of the output.
+type MyCBCCS struct {
+	iv      []byte
+	block   cipher.Block
+	variant CTSVariant
+}
+
+func NewMyCBCCS(b cipher.Block, iv []byte, variant CTSVariant) *MyCBCCS {
+	if len(iv) != b.BlockSize() || variant < CS1 || variant > CS3 {
+		return nil
+	}
+
+	return &MyCBCCS{
+		iv:      dup(iv),
+		block:   b,
+		variant: variant,
+	}
+}
+
+// BlockSize returns the mode's block size.
+func (cs *MyCBCCS) BlockSize() int {
+	return cs.block.BlockSize()
+}
+
+// Encrypt encrypts src into dst, which must be at least as long. It
+// returns ErrShortInput if src is shorter than one block. Dst and src may
+// point to the same memory.
+func (cs *MyCBCCS) Encrypt(dst, src []byte) error {
+	blockSize := cs.BlockSize()
+	n := len(src)
+	if n < blockSize {
+		return ErrShortInput
+	}
+	if len(dst) < n {
+		panic("len(dst) < len(src)")
+	}
+
+	enc := NewMyCBCEncrypter(cs.block, cs.iv)
+	d := n % blockSize
+	if d == 0 {
+		enc.CryptBlocks(dst[:n], src)
+		if cs.variant == CS3 && n > blockSize {
+			swapBlocks(dst[n-2*blockSize:n-blockSize], dst[n-blockSize:n])
+		}
+		return nil
+	}
+
+	// the last block is zero padded, its ciphertext then steals the
+	// padded part of the block before it
+	full := n - d
+	last := make([]byte, blockSize)
+	copy(last, src[full:])
+	enc.CryptBlocks(dst[:full], src[:full])
+	prev := dup(dst[full-blockSize : full])
+	enc.CryptBlocks(last, last)
+
+	if cs.variant == CS1 {
+		copy(dst[full-blockSize:], prev[:d])
+		copy(dst[full-blockSize+d:n], last)
+	} else {
+		copy(dst[full-blockSize:full], last)
+		copy(dst[full:n], prev[:d])
+	}
+
+	return nil
+}
+
+// Decrypt decrypts src into dst, which must be at least as long. It
+// returns ErrShortInput if src is shorter than one block. Dst and src may
+// point to the same memory.
+func (cs *MyCBCCS) Decrypt(dst, src []byte) error {
+	blockSize := cs.BlockSize()
+	n := len(src)
+	if n < blockSize {
+		return ErrShortInput
+	}
+	if len(dst) < n {
+		panic("len(dst) < len(src)")
+	}
+
+	dec := NewMyCBCDecrypter(cs.block, cs.iv)
+	if n == blockSize {
+		dec.CryptBlocks(dst[:n], src)
+		return nil
+	}
+
+	// split off the last two blocks, the only ones that differ from CBC
+	d := n % blockSize
+	if d == 0 {
+		d = blockSize
+	}
+	head := n - blockSize - d
+	var prev, last []byte
+	if cs.variant == CS1 || (cs.variant == CS2 && d == blockSize) {
+		prev = dup(src[head : head+d])
+		last = dup(src[head+d : n])
+	} else {
+		last = dup(src[head : head+blockSize])
+		prev = dup(src[head+blockSize : n])
+	}
+
+	dec.CryptBlocks(dst[:head], src[:head])
+	if d == blockSize {
+		dec.CryptBlocks(dst[head:head+blockSize], prev)
+		dec.CryptBlocks(dst[head+blockSize:n], last)
+		return nil
+	}
+
+	// D(last) is the zero padded last plaintext block XOR the whole
+	// previous ciphertext block, whose stolen tail it gives back
+	z := make([]byte, blockSize)
+	cs.block.Decrypt(z, last)
+	prev = append(prev, z[d:]...)
+	dec.CryptBlocks(dst[head:head+blockSize], prev)
+	xorSlice(dst[head+blockSize:n], z[:d], prev[:d])
+
+	return nil
+}
+
+func swapBlocks(a, b []byte) {
+	for k := range a {
+		a[k], b[k] = b[k], a[k]
+	}
+}
@@ -0,0 +1,110 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// ctsVectors are the AES CBC-CS3 vectors of RFC 3962 appendix B, with the
+// key "chicken teriyaki" and a zero IV.
+var ctsVectors = []struct {
+	plaintext  string
+	ciphertext string
+}{
+	{"I would like the ", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+	{"I would like the General Gau's ", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+	{"I would like the General Gau's C", "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+	{"I would like the General Gau's Chicken, please,", "97687268d6ecccc0c07b25e25ecfe584b3fffd940c16a18c1b5549d2f838029e39312523a78662d5be7fcbcc98ebf5"},
+	{"I would like the General Gau's Chicken, please, ", "97687268d6ecccc0c07b25e25ecfe5849dad8bbb96c4cdc03bc103e1a194bbd839312523a78662d5be7fcbcc98ebf5a8"},
+	{"I would like the General Gau's Chicken, please, and wonton soup.", "97687268d6ecccc0c07b25e25ecfe58439312523a78662d5be7fcbcc98ebf5a84807efe836ee89a526730dbc2f7bc8409dad8bbb96c4cdc03bc103e1a194bbd8"},
+}
+
+// unsteal reorders a CS3 ciphertext into the given variant: CS2 only keeps
+// the swap for a partial last block and CS1 never swaps.
+func unsteal(cs3 []byte, variant modes.CTSVariant) []byte {
+	n := len(cs3)
+	d := n % aes.BlockSize
+	if n <= aes.BlockSize || variant == modes.CS3 || (variant == modes.CS2 && d != 0) {
+		return cs3
+	}
+	if d == 0 {
+		d = aes.BlockSize
+	}
+
+	head := n - aes.BlockSize - d
+	out := append([]byte(nil), cs3[:head]...)
+	out = append(out, cs3[head+aes.BlockSize:]...)
+	return append(out, cs3[head:head+aes.BlockSize]...)
+}
+
+func TestCTSVectors(t *testing.T) {
+	block, err := aes.NewCipher([]byte("chicken teriyaki"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+
+	for _, v := range ctsVectors {
+		for _, variant := range []modes.CTSVariant{modes.CS1, modes.CS2, modes.CS3} {
+			cs := modes.NewMyCBCCS(block, iv, variant)
+			want := unsteal(testutil.Unhex(v.ciphertext), variant)
+
+			got := make([]byte, len(v.plaintext))
+			if err := cs.Encrypt(got, []byte(v.plaintext)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("CS%d %q: got %x, want %x", variant, v.plaintext, got, want)
+			}
+
+			if err := cs.Decrypt(got, got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != v.plaintext {
+				t.Fatalf("CS%d %q: decrypted to %q", variant, v.plaintext, got)
+			}
+		}
+	}
+}
+
+func TestCTSRoundTrip(t *testing.T) {
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variant := range []modes.CTSVariant{modes.CS1, modes.CS2, modes.CS3} {
+		cs := modes.NewMyCBCCS(block, iv, variant)
+		if err := cs.Encrypt(make([]byte, 15), make([]byte, 15)); err != modes.ErrShortInput {
+			t.Fatalf("CS%d accepted a short input: %v", variant, err)
+		}
+
+		for n := aes.BlockSize; n < 5*aes.BlockSize; n++ {
+			plaintext := make([]byte, n)
+			if _, err := rand.Read(plaintext); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := append([]byte(nil), plaintext...)
+			if err := cs.Encrypt(buf, buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := cs.Decrypt(buf, buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, plaintext) {
+				t.Fatalf("CS%d: %d byte round trip failed", variant, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// MyInsecureECBEncrypter is ECB, which encrypts every block on its own.
+// Equal plaintext blocks give equal ciphertext blocks, so ECB shows the
+// structure of the message through the encryption; it is only here to
+// read data written by legacy systems. There is no IV, so the wire format
+// is just the padded ciphertext.
+type MyInsecureECBEncrypter struct {
+	block   cipher.Block
+	padding Padding
+}
+
+// BlockSize returns the mode's block size.
+func (enc *MyInsecureECBEncrypter) BlockSize() int {
+	return enc.block.BlockSize()
+}
+
+// EncryptedSize returns how long Encrypt's output for srcLen bytes can be.
+func (enc *MyInsecureECBEncrypter) EncryptedSize(srcLen int) int {
+	return srcLen + enc.BlockSize() - srcLen%enc.BlockSize()
+}
+
+// CryptBlocks encrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+func (enc *MyInsecureECBEncrypter) CryptBlocks(dst, src []byte) {
+	blockSize := enc.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		enc.block.Encrypt(dst[i:i+blockSize], src[i:i+blockSize])
+	}
+}
+
+// Encrypt pads src and writes its encryption to dst, returning the written
+// part of dst. len(dst) must be at least EncryptedSize(len(src)).
+func (enc *MyInsecureECBEncrypter) Encrypt(dst, src []byte) []byte {
+	if len(dst) < enc.EncryptedSize(len(src)) {
+		panic("len(dst) < enc.EncryptedSize(len(src))")
+	}
+
+	return encryptPadded(dst, nil, src, enc, enc.padding)
+}
+
+// NewMyInsecureECBEncrypter returns an ECB encrypter that pads with PKCS#7.
+func NewMyInsecureECBEncrypter(b cipher.Block) *MyInsecureECBEncrypter {
+	return NewMyInsecureECBEncrypterWithPadding(b, PKCS7Padding)
+}
+
+// NewMyInsecureECBEncrypterWithPadding returns an ECB encrypter whose
+// Encrypt uses the given padding.
+func NewMyInsecureECBEncrypterWithPadding(b cipher.Block, padding Padding) *MyInsecureECBEncrypter {
+	return &MyInsecureECBEncrypter{
+		block:   b,
+		padding: padding,
+	}
+}
+
+// MyInsecureECBDecrypter decrypts what MyInsecureECBEncrypter encrypts.
+type MyInsecureECBDecrypter struct {
+	block   cipher.Block
+	padding Padding
+}
+
+// BlockSize returns the mode's block size.
+func (dec *MyInsecureECBDecrypter) BlockSize() int {
+	return dec.block.BlockSize()
+}
+
+// CryptBlocks decrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+func (dec *MyInsecureECBDecrypter) CryptBlocks(dst, src []byte) {
+	blockSize := dec.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		dec.block.Decrypt(dst[i:i+blockSize], src[i:i+blockSize])
+	}
+}
+
+// Decrypt decrypts src as written by MyInsecureECBEncrypter.Encrypt and
+// returns the plaintext with the padding removed. len(dst) must be at
+// least len(src).
+func (dec *MyInsecureECBDecrypter) Decrypt(dst, src []byte) ([]byte, error) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	return decryptPadded(dst, src, dec, dec.padding)
+}
+
+// NewMyInsecureECBDecrypter returns an ECB decrypter that expects PKCS#7
+// padding.
+func NewMyInsecureECBDecrypter(b cipher.Block) *MyInsecureECBDecrypter {
+	return NewMyInsecureECBDecrypterWithPadding(b, PKCS7Padding)
+}
+
+// NewMyInsecureECBDecrypterWithPadding returns an ECB decrypter whose
+// Decrypt expects the given padding.
+func NewMyInsecureECBDecrypterWithPadding(b cipher.Block, padding Padding) *MyInsecureECBDecrypter {
+	return &MyInsecureECBDecrypter{
+		block:   b,
+		padding: padding,
+	}
+}
@@ -0,0 +1,49 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var ecbVectors = []sp80038aVector{
+	{"F.1.1 ECB-AES128", 0, "", "3ad77bb40d7a3660a89ecaf32466ef97 f5d3d58503b9699de785895a96fdbaaf 43b1cd7f598ece23881b00e3ed030688 7b0c785e27e8ad3f8223207104725dd4"},
+	{"F.1.3 ECB-AES192", 1, "", "bd334f1d6e45f25ff712a214571fa5cc 974104846d0ad3ad7734ecb3ecee4eef ef7afd2270e2e60adce0ba2face6444e 9a4b41ba738d6c72fb16691603c18e0e"},
+	{"F.1.5 ECB-AES256", 2, "", "f3eed1bdb5d2a03c064b5a7e3db181f8 591ccb10d410ed26dc5ba74a31362870 b6ed21b99ca6f4f9f153e7b1beafed1d 23304b7a39f9f3ff067d8d8f9e24ecc7"},
+}
+
+func TestSP80038AECB(t *testing.T) {
+	pt := testutil.Unhex(sp80038aPlaintext)
+	for _, v := range ecbVectors {
+		block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[v.key]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		modes.NewMyInsecureECBEncrypter(block).CryptBlocks(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+		modes.NewMyInsecureECBDecrypter(block).CryptBlocks(got, want)
+		if !bytes.Equal(got, pt) {
+			t.Errorf("%s: decrypt got %x, want %x", v.name, got, pt)
+		}
+
+		enc := modes.NewMyInsecureECBEncrypter(block)
+		wire := enc.Encrypt(make([]byte, enc.EncryptedSize(len(pt))), pt)
+		if !bytes.Equal(wire[:len(want)], want) || len(wire) != len(want)+aes.BlockSize {
+			t.Errorf("%s: Encrypt got %x", v.name, wire)
+		}
+		plain, err := modes.NewMyInsecureECBDecrypter(block).Decrypt(make([]byte, len(wire)), wire)
+		if err != nil {
+			t.Errorf("%s: Decrypt failed with: %v", v.name, err)
+		} else if !bytes.Equal(plain, pt) {
+			t.Errorf("%s: Decrypt got %x, want %x", v.name, plain, pt)
+		}
+	}
+}
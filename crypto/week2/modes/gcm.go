@@ -0,0 +1,208 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/sliceutil"
+)
+
+const (
+	gcmBlockSize         = 16
+	gcmStandardNonceSize = 12
+	gcmTagSize           = 16
+	gcmMinimumTagSize    = 12
+)
+
+var errOpen = errors.New("modes: message authentication failed")
+
+// myGCM is GCM (NIST SP 800-38D) built from a GHASH over GF(2^128) and
+// the MyCTR key stream with a 32-bit counter.
+type myGCM struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+	// h is the hash key E(K, 0^128) as two big-endian halves.
+	h [2]uint64
+}
+
+// NewMyGCM returns the given 128-bit block cipher wrapped in Galois Counter
+// Mode with the standard 12-byte nonce and 16-byte tag.
+func NewMyGCM(b cipher.Block) (cipher.AEAD, error) {
+	return newMyGCM(b, gcmStandardNonceSize, gcmTagSize)
+}
+
+// NewMyGCMWithNonceSize is NewMyGCM with a non-standard nonce length,
+// which is only useful to talk to other implementations that use one.
+func NewMyGCMWithNonceSize(b cipher.Block, size int) (cipher.AEAD, error) {
+	return newMyGCM(b, size, gcmTagSize)
+}
+
+// NewMyGCMWithTagSize is NewMyGCM with a tag truncated to between 12 and 16
+// bytes.
+func NewMyGCMWithTagSize(b cipher.Block, size int) (cipher.AEAD, error) {
+	return newMyGCM(b, gcmStandardNonceSize, size)
+}
+
+func newMyGCM(b cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if b.BlockSize() != gcmBlockSize {
+		return nil, errors.New("modes: GCM requires a 128-bit block cipher")
+	}
+	if nonceSize <= 0 {
+		return nil, errors.New("modes: GCM nonce size can't be zero")
+	}
+	if tagSize < gcmMinimumTagSize || tagSize > gcmTagSize {
+		return nil, errors.New("modes: invalid GCM tag size")
+	}
+
+	var key [gcmBlockSize]byte
+	b.Encrypt(key[:], key[:])
+
+	return &myGCM{
+		block:     b,
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+		h:         [2]uint64{binary.BigEndian.Uint64(key[:8]), binary.BigEndian.Uint64(key[8:])},
+	}, nil
+}
+
+func (g *myGCM) NonceSize() int {
+	return g.nonceSize
+}
+
+func (g *myGCM) Overhead() int {
+	return g.tagSize
+}
+
+func (g *myGCM) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != g.nonceSize {
+		panic("modes: incorrect nonce length given to GCM")
+	}
+	if uint64(len(plaintext)) > (1<<32-2)*gcmBlockSize {
+		panic("modes: message too large for GCM")
+	}
+
+	ret, out := sliceutil.ForAppend(dst, len(plaintext)+g.tagSize)
+
+	j0 := g.deriveCounter(nonce)
+	g.counterStream(j0).XORKeyStream(out, plaintext)
+
+	tag := g.tag(j0, out[:len(plaintext)], additionalData)
+	copy(out[len(plaintext):], tag)
+
+	return ret
+}
+
+func (g *myGCM) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != g.nonceSize {
+		panic("modes: incorrect nonce length given to GCM")
+	}
+	if len(ciphertext) < g.tagSize {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > (1<<32-2)*gcmBlockSize+uint64(g.tagSize) {
+		return nil, errOpen
+	}
+
+	tagged := len(ciphertext) - g.tagSize
+	j0 := g.deriveCounter(nonce)
+	tag := g.tag(j0, ciphertext[:tagged], additionalData)
+	if subtle.ConstantTimeCompare(tag, ciphertext[tagged:]) != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceutil.ForAppend(dst, tagged)
+	g.counterStream(j0).XORKeyStream(out, ciphertext[:tagged])
+
+	return ret, nil
+}
+
+// deriveCounter returns the pre-counter block J0 for nonce.
+func (g *myGCM) deriveCounter(nonce []byte) []byte {
+	j0 := make([]byte, gcmBlockSize)
+	if len(nonce) == gcmStandardNonceSize {
+		copy(j0, nonce)
+		j0[gcmBlockSize-1] = 1
+		return j0
+	}
+
+	var y [2]uint64
+	g.ghashUpdate(&y, nonce)
+	g.ghashLengths(&y, 0, uint64(len(nonce))*8)
+	binary.BigEndian.PutUint64(j0, y[0])
+	binary.BigEndian.PutUint64(j0[8:], y[1])
+	return j0
+}
+
+// counterStream returns the key stream for the plaintext, which starts one
+// block after j0 and only increments the last 32 bits.
+func (g *myGCM) counterStream(j0 []byte) *MyCTR {
+	counter := make([]byte, gcmBlockSize)
+	addCounter(counter, j0, 1, 4)
+	ctr := NewMyCTRWithCounter(g.block, counter, 4)
+	// the counter wraps within the nonce's 2^32 blocks, like the spec
+	ctr.left = 1<<32 - 2
+	return ctr
+}
+
+// tag computes the authentication tag over the ciphertext and the
+// additional data.
+func (g *myGCM) tag(j0, ciphertext, additionalData []byte) []byte {
+	var y [2]uint64
+	g.ghashUpdate(&y, additionalData)
+	g.ghashUpdate(&y, ciphertext)
+	g.ghashLengths(&y, uint64(len(additionalData))*8, uint64(len(ciphertext))*8)
+
+	tag := make([]byte, gcmBlockSize)
+	g.block.Encrypt(tag, j0)
+	binary.BigEndian.PutUint64(tag, binary.BigEndian.Uint64(tag)^y[0])
+	binary.BigEndian.PutUint64(tag[8:], binary.BigEndian.Uint64(tag[8:])^y[1])
+
+	return tag[:g.tagSize]
+}
+
+// ghashUpdate absorbs data, zero padded to a whole number of blocks.
+func (g *myGCM) ghashUpdate(y *[2]uint64, data []byte) {
+	var block [gcmBlockSize]byte
+	for len(data) > 0 {
+		n := copy(block[:], data)
+		for k := n; k < gcmBlockSize; k++ {
+			block[k] = 0
+		}
+		data = data[n:]
+
+		y[0] ^= binary.BigEndian.Uint64(block[:8])
+		y[1] ^= binary.BigEndian.Uint64(block[8:])
+		gfMul(y, &g.h)
+	}
+}
+
+// ghashLengths absorbs the final block of bit lengths.
+func (g *myGCM) ghashLengths(y *[2]uint64, aadBits, dataBits uint64) {
+	y[0] ^= aadBits
+	y[1] ^= dataBits
+	gfMul(y, &g.h)
+}
+
+// gfMul sets x to x*h in GF(2^128) with the GCM bit order, where the first
+// bit of the block is the coefficient of x^0. It runs in constant time.
+func gfMul(x, h *[2]uint64) {
+	var z [2]uint64
+	v := *h
+	for i := 0; i < 128; i++ {
+		// bit i of x, counting from the most significant bit of x[0]
+		bit := (x[i/64] >> uint(63-i%64)) & 1
+		mask := -bit
+		z[0] ^= v[0] & mask
+		z[1] ^= v[1] & mask
+
+		// v = v * x, reducing by x^128 + x^7 + x^2 + x + 1
+		reduce := -(v[1] & 1)
+		v[1] = v[1]>>1 | v[0]<<63
+		v[0] = v[0]>>1 ^ 0xe100000000000000&reduce
+	}
+
+	*x = z
+}
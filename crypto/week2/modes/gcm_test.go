@@ -0,0 +1,163 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// gcmVectors are test cases 1-6 and 13-16 of "The Galois/Counter Mode of
+// Operation (GCM)", the submission NIST validates SP 800-38D against.
+var gcmVectors = []struct {
+	key, iv, plaintext, aad, ciphertext, tag string
+}{
+	{
+		"00000000000000000000000000000000",
+		"000000000000000000000000",
+		"",
+		"",
+		"",
+		"58e2fccefa7e3061367f1d57a4e7455a",
+	},
+	{
+		"00000000000000000000000000000000",
+		"000000000000000000000000",
+		"00000000000000000000000000000000",
+		"",
+		"0388dace60b6a392f328c2b971b2fe78",
+		"ab6e47d42cec13bdf53a67b21257bddf",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308",
+		"cafebabefacedbaddecaf888",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255",
+		"",
+		"42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091473f5985",
+		"4d5c2af327cd64a62cf35abd2ba6fab4",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308",
+		"cafebabefacedbaddecaf888",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		"feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		"42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091",
+		"5bc94fbc3221a5db94fae95ae7121a47",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308",
+		"cafebabefacedbad",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		"feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		"61353b4c2806934a777ff51fa22a4755699b2a714fcdc6f83766e5f97b6c742373806900e49f24b22b097544d4896b424989b5e1ebac0f07c23f4598",
+		"3612d2e79e3b0785561be14aaca2fccb",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308",
+		"9313225df88406e555909c5aff5269aa6a7a9538534f7da1e4c303d2a318a728c3c0c95156809539fcf0e2429a6b525416aedbf5a0de6a57a637b39b",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		"feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		"8ce24998625615b603a033aca13fb894be9112a5c3a211a8ba262a3cca7e2ca701e4a9a4fba43c90ccdcb281d48c7c6fd62875d2aca417034c34aee5",
+		"619cc5aefffe0bfa462af43c1699d050",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"000000000000000000000000",
+		"",
+		"",
+		"",
+		"530f8afbc74536b9a963b4f1c4cb738b",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"000000000000000000000000",
+		"00000000000000000000000000000000",
+		"",
+		"cea7403d4d606b6e074ec5d3baf39d18",
+		"d0d1c8a799996bf0265b98b5d48ab919",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+		"cafebabefacedbaddecaf888",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255",
+		"",
+		"522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662898015ad",
+		"b094dac5d93471bdec1a502270e3cc6c",
+	},
+	{
+		"feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+		"cafebabefacedbaddecaf888",
+		"d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		"feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		"522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662",
+		"76fc6ece0f4e1768cddf8853bb2d551b",
+	},
+}
+
+func TestGCMVectors(t *testing.T) {
+	for i, v := range gcmVectors {
+		block, err := aes.NewCipher(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv := testutil.Unhex(v.iv)
+		aead, err := modes.NewMyGCMWithNonceSize(block, len(iv))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := append(testutil.Unhex(v.ciphertext), testutil.Unhex(v.tag)...)
+		got := aead.Seal(nil, iv, testutil.Unhex(v.plaintext), testutil.Unhex(v.aad))
+		if !bytes.Equal(got, want) {
+			t.Fatalf("vector %d: Seal got %x, want %x", i, got, want)
+		}
+
+		plain, err := aead.Open(nil, iv, want, testutil.Unhex(v.aad))
+		if err != nil || !bytes.Equal(plain, testutil.Unhex(v.plaintext)) {
+			t.Fatalf("vector %d: Open failed: %v", i, err)
+		}
+
+		want[0] ^= 1
+		if _, err := aead.Open(nil, iv, want, testutil.Unhex(v.aad)); err == nil {
+			t.Fatalf("vector %d: Open accepted a forged message", i)
+		}
+	}
+}
+
+func TestGCMCryptoCipher(t *testing.T) {
+	for i := 0; i < 500; i++ {
+		key := make([]byte, 16+8*mrand.Intn(3))
+		nonce := make([]byte, 1+mrand.Intn(32))
+		plaintext := make([]byte, mrand.Intn(200))
+		aad := make([]byte, mrand.Intn(50))
+		for _, b := range [][]byte{key, nonce, plaintext, aad} {
+			if _, err := rand.Read(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mine, err := modes.NewMyGCMWithNonceSize(block, len(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := mine.Seal(nil, nonce, plaintext, aad)
+		want := theirs.Seal(nil, nonce, plaintext, aad)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("key %x nonce %x: got %x, want %x", key, nonce, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const keyWrapBlockSize = 16
+
+var (
+	// ErrKeyWrapBlockSize is returned by the key wrap functions for a
+	// cipher whose block is not 128 bits.
+	ErrKeyWrapBlockSize = errors.New("modes: key wrap needs a 128-bit block cipher")
+	// ErrWrapLength is returned for a key that can't be wrapped: for KW
+	// one shorter than 16 bytes or not a multiple of 8, for KWP an empty
+	// one or one of 4 GiB or more.
+	ErrWrapLength = errors.New("modes: invalid length of key to wrap")
+	// ErrUnwrapLength is returned for a wrapped key whose length no
+	// wrapping gives.
+	ErrUnwrapLength = errors.New("modes: invalid length of wrapped key")
+	// ErrUnwrapIntegrity is returned when the integrity check value of a
+	// wrapped key doesn't match, because it was wrapped under another KEK
+	// or changed afterwards.
+	ErrUnwrapIntegrity = errors.New("modes: wrapped key integrity check failed")
+)
+
+// keyWrapIV is the default initial value of RFC 3394 section 2.2.3.1.
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// kwpIVPrefix is the alternative initial value of RFC 5649 section 3,
+// followed by the big-endian key length.
+var kwpIVPrefix = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// WrapKey wraps key under the key encryption key b with AES Key Wrap
+// (RFC 3394, NIST SP 800-38F KW). The key must be a multiple of 8 bytes
+// and at least 16 bytes long; the result is 8 bytes longer.
+func WrapKey(b cipher.Block, key []byte) ([]byte, error) {
+	if b.BlockSize() != keyWrapBlockSize {
+		return nil, ErrKeyWrapBlockSize
+	}
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, ErrWrapLength
+	}
+
+	return wrap(b, keyWrapIV, key), nil
+}
+
+// UnwrapKey unwraps what WrapKey returns, checking its integrity.
+func UnwrapKey(b cipher.Block, wrapped []byte) ([]byte, error) {
+	if b.BlockSize() != keyWrapBlockSize {
+		return nil, ErrKeyWrapBlockSize
+	}
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrUnwrapLength
+	}
+
+	a, key := unwrap(b, wrapped)
+	if subtle.ConstantTimeCompare(a, keyWrapIV) != 1 {
+		return nil, ErrUnwrapIntegrity
+	}
+
+	return key, nil
+}
+
+// WrapKeyWithPadding wraps a key of any length from 1 byte under b with
+// AES Key Wrap with Padding (RFC 5649, SP 800-38F KWP). The key is zero
+// padded to a multiple of 8 bytes and its length goes into the initial
+// value; a key of up to 8 bytes is a single block encryption.
+func WrapKeyWithPadding(b cipher.Block, key []byte) ([]byte, error) {
+	if b.BlockSize() != keyWrapBlockSize {
+		return nil, ErrKeyWrapBlockSize
+	}
+	if len(key) == 0 || uint64(len(key)) > 0xffffffff {
+		return nil, ErrWrapLength
+	}
+
+	aiv := make([]byte, 8)
+	copy(aiv, kwpIVPrefix)
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(key)))
+
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+	if len(padded) == 8 {
+		out := append(aiv, padded...)
+		b.Encrypt(out, out)
+		return out, nil
+	}
+
+	return wrap(b, aiv, padded), nil
+}
+
+// UnwrapKeyWithPadding unwraps what WrapKeyWithPadding returns, checking
+// the initial value, the length and that the padding is zero.
+func UnwrapKeyWithPadding(b cipher.Block, wrapped []byte) ([]byte, error) {
+	if b.BlockSize() != keyWrapBlockSize {
+		return nil, ErrKeyWrapBlockSize
+	}
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, ErrUnwrapLength
+	}
+
+	var a, padded []byte
+	if len(wrapped) == 16 {
+		out := make([]byte, 16)
+		b.Decrypt(out, wrapped)
+		a, padded = out[:8], out[8:]
+	} else {
+		a, padded = unwrap(b, wrapped)
+	}
+
+	// the length must leave 0 to 7 bytes of padding, which must be zero;
+	// the padding is checked in full whatever fails
+	good := subtle.ConstantTimeCompare(a[:4], kwpIVPrefix)
+	n := len(padded)
+	if l := binary.BigEndian.Uint32(a[4:]); uint64(l) > uint64(len(padded)) || int(l) <= len(padded)-8 {
+		good = 0
+	} else {
+		n = int(l)
+	}
+	for k := len(padded) - 7; k < len(padded); k++ {
+		inPadding := subtle.ConstantTimeLessOrEq(n, k)
+		good &= subtle.ConstantTimeSelect(inPadding, subtle.ConstantTimeByteEq(padded[k], 0), 1)
+	}
+	if good != 1 {
+		return nil, ErrUnwrapIntegrity
+	}
+
+	return padded[:n], nil
+}
+
+// wrap is the wrapping process W of RFC 3394 section 2.2.1, with the
+// initial value iv and n 64-bit blocks of plaintext, n >= 2.
+func wrap(b cipher.Block, iv, plaintext []byte) []byte {
+	n := len(plaintext) / 8
+	out := make([]byte, 8+len(plaintext))
+	copy(out, iv)
+	copy(out[8:], plaintext)
+	a, r := out[:8], out[8:]
+
+	buf := make([]byte, keyWrapBlockSize)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[8*i:8*i+8])
+			b.Encrypt(buf, buf)
+
+			// A = MSB(64, B) ^ t with t = n*j+i, counting from 1
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf)^t)
+			copy(r[8*i:], buf[8:])
+		}
+	}
+
+	return out
+}
+
+// unwrap is the unwrapping process W^-1 and returns the recovered initial
+// value and plaintext.
+func unwrap(b cipher.Block, wrapped []byte) ([]byte, []byte) {
+	n := len(wrapped)/8 - 1
+	out := dup(wrapped)
+	a, r := out[:8], out[8:]
+
+	buf := make([]byte, keyWrapBlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[8*i:8*i+8])
+			b.Decrypt(buf, buf)
+
+			copy(a, buf[:8])
+			copy(r[8*i:], buf[8:])
+		}
+	}
+
+	return a, r
+}
@@ -0,0 +1,127 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/des"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// keyWrapVectors are the examples of RFC 3394 section 4 and, marked pad,
+// RFC 5649 section 6.
+var keyWrapVectors = []struct {
+	name    string
+	kek     string
+	key     string
+	wrapped string
+	pad     bool
+}{
+	{"RFC 3394 4.1", "000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5", false},
+	{"RFC 3394 4.2", "000102030405060708090a0b0c0d0e0f1011121314151617", "00112233445566778899aabbccddeeff", "96778b25ae6ca435f92b5b97c050aed2468ab8a17ad84e5d", false},
+	{"RFC 3394 4.3", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff", "64e8c3f9ce0f5ba263e9777905818a2a93c8191e7d6e8ae7", false},
+	{"RFC 3394 4.4", "000102030405060708090a0b0c0d0e0f1011121314151617", "00112233445566778899aabbccddeeff0001020304050607", "031d33264e15d33268f24ec260743edce1c6c7ddee725a936ba814915c6762d2", false},
+	{"RFC 3394 4.5", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff0001020304050607", "a8f9bc1612c68b3ff6e6f4fbe30e71e4769c8b80a32cb8958cd5d17d6b254da1", false},
+	{"RFC 3394 4.6", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f", "28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21", false},
+	{"RFC 5649 20 bytes", "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a", true},
+	{"RFC 5649 7 bytes", "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f", true},
+}
+
+func TestKeyWrapVectors(t *testing.T) {
+	for _, v := range keyWrapVectors {
+		kek, err := aes.NewCipher(testutil.Unhex(v.kek))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrap, unwrap := modes.WrapKey, modes.UnwrapKey
+		if v.pad {
+			wrap, unwrap = modes.WrapKeyWithPadding, modes.UnwrapKeyWithPadding
+		}
+		key, want := testutil.Unhex(v.key), testutil.Unhex(v.wrapped)
+
+		got, err := wrap(kek, key)
+		if err != nil {
+			t.Fatalf("%s: wrap failed with: %v", v.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: wrap got %x, want %x", v.name, got, want)
+		}
+		plain, err := unwrap(kek, want)
+		if err != nil {
+			t.Fatalf("%s: unwrap failed with: %v", v.name, err)
+		}
+		if !bytes.Equal(plain, key) {
+			t.Fatalf("%s: unwrap got %x, want %x", v.name, plain, key)
+		}
+
+		for k := range want {
+			bad := append([]byte(nil), want...)
+			bad[k] ^= 0x80
+			if _, err := unwrap(kek, bad); err != modes.ErrUnwrapIntegrity {
+				t.Fatalf("%s: unwrap with byte %d changed returned %v", v.name, k, err)
+			}
+		}
+	}
+}
+
+// TestKeyWrapErrors checks that every kind of bad input gets its own
+// error.
+func TestKeyWrapErrors(t *testing.T) {
+	kek, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdes, err := des.NewTripleDESCipher(make([]byte, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"KW of 8 bytes", second(modes.WrapKey(kek, make([]byte, 8))), modes.ErrWrapLength},
+		{"KW of 20 bytes", second(modes.WrapKey(kek, make([]byte, 20))), modes.ErrWrapLength},
+		{"KW unwrap of 16 bytes", second(modes.UnwrapKey(kek, make([]byte, 16))), modes.ErrUnwrapLength},
+		{"KW unwrap of 25 bytes", second(modes.UnwrapKey(kek, make([]byte, 25))), modes.ErrUnwrapLength},
+		{"KW with 3DES", second(modes.WrapKey(tdes, make([]byte, 16))), modes.ErrKeyWrapBlockSize},
+		{"KWP of nothing", second(modes.WrapKeyWithPadding(kek, nil)), modes.ErrWrapLength},
+		{"KWP unwrap of 8 bytes", second(modes.UnwrapKeyWithPadding(kek, make([]byte, 8))), modes.ErrUnwrapLength},
+		{"KWP with 3DES", second(modes.UnwrapKeyWithPadding(tdes, make([]byte, 16))), modes.ErrKeyWrapBlockSize},
+	}
+	for _, c := range cases {
+		if c.err != c.want {
+			t.Fatalf("%s: got %v, want %v", c.name, c.err, c.want)
+		}
+	}
+
+	// KW and KWP must not take each other's output
+	kw, _ := modes.WrapKey(kek, make([]byte, 16))
+	if _, err := modes.UnwrapKeyWithPadding(kek, kw); err != modes.ErrUnwrapIntegrity {
+		t.Fatalf("KWP unwrap of KW output returned %v", err)
+	}
+	kwp, _ := modes.WrapKeyWithPadding(kek, make([]byte, 16))
+	if _, err := modes.UnwrapKey(kek, kwp); err != modes.ErrUnwrapIntegrity {
+		t.Fatalf("KW unwrap of KWP output returned %v", err)
+	}
+
+	// every length round trips, the padding included
+	for n := 1; n <= 40; n++ {
+		key := bytes.Repeat([]byte{byte(n)}, n)
+		wrapped, err := modes.WrapKeyWithPadding(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := modes.UnwrapKeyWithPadding(kek, wrapped)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Fatalf("KWP of %d bytes doesn't round trip: %v", n, err)
+		}
+	}
+}
+
+func second(_ []byte, err error) error {
+	return err
+}
@@ -0,0 +1,92 @@
+// Package modes implements the block cipher modes of week2.
+//
+// MyCBCEncrypter and MyCBCDecrypter satisfy cipher.BlockMode and MyCTR
+// satisfies cipher.Stream, so they can be used wherever the crypto/cipher
+// modes are. On top of that, their Encrypt and Decrypt methods read and
+// write the course wire format, where the IV is the first block of the
+// ciphertext and CBC plaintexts are PKCS#7 padded. The same format can be
+// streamed with NewCBCEncryptWriter, NewCBCDecryptReader, NewCTRWriter and
+// NewCTRReader.
+//
+// The legacy modes follow the same conventions: MyPCBCEncrypter and
+// MyPCBCDecrypter like CBC, MyCFB and MyOFB like CTR, and ECB, which has
+// no IV, as MyInsecureECBEncrypter and MyInsecureECBDecrypter. MyXTS is
+// for storage and encrypts sectors in place, without an IV on the wire.
+package modes
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+var (
+	// ErrShortCiphertext is returned when a ciphertext is too short to
+	// hold the IV and a padded block, or is not a whole number of blocks.
+	ErrShortCiphertext = errors.New("modes: ciphertext too short or not a multiple of the block size")
+	// ErrInvalidPadding is returned when the decrypted padding is malformed.
+	ErrInvalidPadding = errors.New("modes: invalid padding")
+	// ErrShortInput is returned by ciphertext stealing for inputs shorter
+	// than one block.
+	ErrShortInput = errors.New("modes: input shorter than one block")
+	// ErrCounterOverflow is returned when a CTR counter would wrap around
+	// and repeat key stream.
+	ErrCounterOverflow = errors.New("modes: counter overflow")
+)
+
+var (
+	_ cipher.BlockMode = (*MyCBCEncrypter)(nil)
+	_ cipher.BlockMode = (*MyCBCDecrypter)(nil)
+	_ cipher.Stream    = (*MyCTR)(nil)
+	_ cipher.BlockMode = (*MyInsecureECBEncrypter)(nil)
+	_ cipher.BlockMode = (*MyInsecureECBDecrypter)(nil)
+	_ cipher.BlockMode = (*MyPCBCEncrypter)(nil)
+	_ cipher.BlockMode = (*MyPCBCDecrypter)(nil)
+	_ cipher.Stream    = (*MyCFB)(nil)
+	_ cipher.Stream    = (*MyOFB)(nil)
+)
+
+// encryptPadded writes iv followed by the encryption of src, padded with
+// padding, to dst and returns the written part of dst. The chaining value
+// of mode must already be set.
+func encryptPadded(dst, iv, src []byte, mode cipher.BlockMode, padding Padding) []byte {
+	blockSize := mode.BlockSize()
+	full := len(src) - len(src)%blockSize
+
+	//set iv to dst
+	n := copy(dst, iv)
+	mode.CryptBlocks(dst[n:n+full], src[:full])
+	n += full
+
+	//padding
+	padded := padding.Pad(append(make([]byte, 0, 2*blockSize), src[full:]...), blockSize)
+	mode.CryptBlocks(dst[n:n+len(padded)], padded)
+
+	return dst[:n+len(padded)]
+}
+
+// decryptPadded decrypts src, which comes after the IV, into dst and
+// returns it with the padding removed, leaving it to the padding to reject
+// an empty src. The chaining value of mode must already be set.
+func decryptPadded(dst, src []byte, mode cipher.BlockMode, padding Padding) ([]byte, error) {
+	blockSize := mode.BlockSize()
+	if len(src)%blockSize != 0 {
+		return nil, ErrShortCiphertext
+	}
+
+	mode.CryptBlocks(dst[:len(src)], src)
+
+	//remove padding
+	return padding.Unpad(dst[:len(src)], blockSize)
+}
+
+func xorSlice(dst, src, key []byte) []byte {
+	for i := 0; i < len(src); i++ {
+		dst[i] = src[i] ^ key[i]
+	}
+
+	return dst
+}
+
+func dup(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
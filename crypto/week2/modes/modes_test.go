@@ -0,0 +1,148 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"math/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// sp80038aPlaintext is the four block plaintext shared by all the examples
+// of NIST SP 800-38A appendix F.
+const sp80038aPlaintext = "6bc1bee22e409f96e93d7e117393172a ae2d8a571e03ac9c9eb76fac45af8e51 30c81c46a35ce411e5fbc1191a0a52ef f69f2445df4f9b17ad2b417be66c3710"
+
+var sp80038aKeys = []string{
+	"2b7e151628aed2a6abf7158809cf4f3c",
+	"8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b",
+	"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4",
+}
+
+const (
+	sp80038aCBCIV = "000102030405060708090a0b0c0d0e0f"
+	sp80038aCTRIV = "f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"
+)
+
+// sp80038aVector is one example of SP 800-38A appendix F, the key being
+// sp80038aKeys[key].
+type sp80038aVector struct {
+	name       string
+	key        int
+	iv         string
+	ciphertext string
+}
+
+// testStreamVectors checks a CFB or OFB flavour against its vectors,
+// encrypting in one go and decrypting a byte at a time.
+func testStreamVectors(t *testing.T, vectors []sp80038aVector, newEnc, newDec func(b cipher.Block, iv []byte) cipher.Stream) {
+	for _, v := range vectors {
+		block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[v.key]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, want := testutil.Unhex(v.iv), testutil.Unhex(v.ciphertext)
+		pt := testutil.Unhex(sp80038aPlaintext)[:len(want)]
+
+		got := make([]byte, len(pt))
+		newEnc(block, iv).XORKeyStream(got, pt)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+
+		dec := newDec(block, iv)
+		for k := range want {
+			dec.XORKeyStream(got[k:k+1], want[k:k+1])
+		}
+		if !bytes.Equal(got, pt) {
+			t.Errorf("%s: decrypt got %x, want %x", v.name, got, pt)
+		}
+	}
+}
+
+// addFuzzSeeds adds random keys, IVs and messages to the seed corpus of a
+// differential fuzz target, so that a plain go test covers more than a
+// handful of inputs.
+func addFuzzSeeds(f *testing.F) {
+	rnd := rand.New(rand.NewSource(1))
+	for k := 0; k < 64; k++ {
+		key := make([]byte, 16+8*(k%3))
+		iv := make([]byte, aes.BlockSize)
+		// mostly short messages, where the edge cases are
+		msg := make([]byte, rnd.Intn(8*aes.BlockSize))
+		if k%8 == 0 {
+			msg = make([]byte, rnd.Intn(16<<10))
+		}
+		cuts := make([]byte, rnd.Intn(4))
+		rnd.Read(key)
+		rnd.Read(iv)
+		rnd.Read(msg)
+		rnd.Read(cuts)
+		f.Add(key, iv, msg, cuts)
+	}
+}
+
+// fuzzPieces returns the lengths of the pieces that cuts cuts n bytes
+// into. Each cut is a piece length in units, the last piece taking what
+// is left.
+func fuzzPieces(n, unit int, cuts []byte) []int {
+	var pieces []int
+	for _, c := range cuts {
+		p := (1 + int(c)) * unit
+		if p >= n {
+			break
+		}
+		pieces = append(pieces, p)
+		n -= p
+	}
+
+	return append(pieces, n)
+}
+
+// feed runs crypt over src in pieces.
+func feed(crypt func(dst, src []byte), dst, src []byte, pieces []int) {
+	off := 0
+	for _, p := range pieces {
+		crypt(dst[off:off+p], src[off:off+p])
+		off += p
+	}
+}
+
+// courseVectors are the four ciphertexts of the week 2 programming
+// assignment, with the messages they decrypt to.
+var courseVectors = []struct {
+	mode       string
+	key        string
+	ciphertext string
+	message    string
+}{
+	{"CBC", "140b41b22a29beb4061bda66b6747e14", "4ca00ff4c898d61e1edbf1800618fb2828a226d160dad07883d04e008a7897ee2e4b7465d5290d0c0e6c6822236e1daafb94ffe0c5da05d9476be028ad7c1d81", "Basic CBC mode encryption needs padding."},
+	{"CBC", "140b41b22a29beb4061bda66b6747e14", "5b68629feb8606f9a6667670b75b38a5b4832d0f26e1ab7da33249de7d4afc48e713ac646ace36e872ad5fb8a512428a6e21364b0c374df45503473c5242a253", "Our implementation uses rand. IV"},
+	{"CTR", "36f18357be4dbd77f050515c73fcf9f2", "69dda8455c7dd4254bf353b773304eec0ec7702330098ce7f7520d1cbbb20fc388d1b0adb5054dbd7370849dbf0b88d393f252e764f1f5f7ad97ef79d59ce29f5f51eeca32eabedd9afa9329", "CTR mode lets you build a stream cipher from a block cipher."},
+	{"CTR", "36f18357be4dbd77f050515c73fcf9f2", "770b80259ec33beb2561358a9f2dc617e46218c0a53cbeca695ae45faa8952aa0e311bde9d4e01726d3184c34451", "Always avoid the two time pad!"},
+}
+
+func TestCourseCiphertexts(t *testing.T) {
+	for _, v := range courseVectors {
+		block, err := aes.NewCipher(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := testutil.Unhex(v.ciphertext)
+		iv := src[:aes.BlockSize]
+
+		var got []byte
+		if v.mode == "CBC" {
+			got, err = modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(src)), src)
+		} else {
+			got, err = modes.NewMyCTR(block, iv).Decrypt(make([]byte, len(src)), src)
+		}
+		if err != nil {
+			t.Errorf("%s %.16s...: Decrypt failed with: %v", v.mode, v.ciphertext, err)
+		} else if !bytes.Equal(got, []byte(v.message)) {
+			t.Errorf("%s %.16s...: got %q, want %q", v.mode, v.ciphertext, got, v.message)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// MyOFB is output feedback mode (SP 800-38A 6.4): the key stream is the
+// IV encrypted over and over. Encryption and decryption are the same.
+type MyOFB struct {
+	iv    []byte
+	block cipher.Block
+	// out is the current key stream block of which used bytes are
+	// already consumed.
+	out  []byte
+	used int
+}
+
+// EncryptedSize returns the length of Encrypt's output for srcLen bytes.
+func (x *MyOFB) EncryptedSize(srcLen int) int {
+	// source len + iv len
+	return srcLen + x.block.BlockSize()
+}
+
+// XORKeyStream XORs each byte in the given slice with a byte from the
+// cipher's key stream. Dst and src may point to the same memory.
+func (x *MyOFB) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for len(src) > 0 {
+		if x.used == len(x.out) {
+			x.block.Encrypt(x.out, x.out)
+			x.used = 0
+		}
+
+		n := len(x.out) - x.used
+		if n > len(src) {
+			n = len(src)
+		}
+		xorSlice(dst[:n], src[:n], x.out[x.used:])
+		x.used += n
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
+
+func (x *MyOFB) reset(iv []byte) {
+	copy(x.out, iv)
+	x.used = len(x.out)
+}
+
+// Encrypt encrypts src from the IV the stream was created with and writes
+// iv||ciphertext to dst, returning the written part of dst.
+// len(dst) must be at least EncryptedSize(len(src)). The IV must not be
+// used for more than one message.
+func (x *MyOFB) Encrypt(dst, src []byte) []byte {
+	n := x.EncryptedSize(len(src))
+	if len(dst) < n {
+		panic("len(dst) < x.EncryptedSize(len(src))")
+	}
+
+	blockSize := x.block.BlockSize()
+	x.reset(x.iv)
+	copy(dst, x.iv)
+	x.XORKeyStream(dst[blockSize:n], src)
+
+	return dst[:n]
+}
+
+// Decrypt decrypts iv||ciphertext as written by Encrypt, taking the IV
+// from the first block of src. len(dst) must be at least
+// len(src) - BlockSize.
+func (x *MyOFB) Decrypt(dst, src []byte) ([]byte, error) {
+	blockSize := x.block.BlockSize()
+	if len(src) < blockSize {
+		return nil, ErrShortCiphertext
+	}
+
+	n := len(src) - blockSize
+	if len(dst) < n {
+		panic("len(dst) < len(src) - block size")
+	}
+
+	x.reset(src[:blockSize])
+	x.XORKeyStream(dst[:n], src[blockSize:])
+
+	return dst[:n], nil
+}
+
+func NewMyOFB(b cipher.Block, iv []byte) *MyOFB {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	x := &MyOFB{
+		iv:    dup(iv),
+		block: b,
+		out:   make([]byte, b.BlockSize()),
+	}
+	x.reset(iv)
+
+	return x
+}
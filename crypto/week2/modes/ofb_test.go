@@ -0,0 +1,43 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var ofbVectors = []sp80038aVector{
+	{"F.4.1 OFB-AES128", 0, sp80038aCBCIV, "3b3fd92eb72dad20333449f8e83cfb4a 7789508d16918f03f53c52dac54ed825 9740051e9c5fecf64344f7a82260edcc 304c6528f659c77866a510d9c1d6ae5e"},
+	{"F.4.3 OFB-AES192", 1, sp80038aCBCIV, "cdc80d6fddf18cab34c25909c99a4174 fcc28b8d4c63837c09e81700c1100401 8d9a9aeac0f6596f559c6d4daf59a5f2 6d9f200857ca6c3e9cac524bd9acc92a"},
+	{"F.4.5 OFB-AES256", 2, sp80038aCBCIV, "dc7e84bfda79164b7ecd8486985d3860 4febdc6740d20b3ac88f6ad82a4fb08d 71ab47a086e86eedf39d1c5bba97c408 0126141d67f37be8538f5a8be740e484"},
+}
+
+func TestSP80038AOFB(t *testing.T) {
+	newOFB := func(b cipher.Block, iv []byte) cipher.Stream { return modes.NewMyOFB(b, iv) }
+	testStreamVectors(t, ofbVectors, newOFB, newOFB)
+}
+
+// FuzzOFB compares MyOFB with crypto/cipher, feeding the message in the
+// pieces cuts cuts it into.
+func FuzzOFB(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, key, iv, msg, cuts []byte) {
+		block, err := aes.NewCipher(key)
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Skip()
+		}
+		pieces := fuzzPieces(len(msg), 1, cuts)
+
+		want := make([]byte, len(msg))
+		cipher.NewOFB(block, iv).XORKeyStream(want, msg)
+
+		got := make([]byte, len(msg))
+		feed(modes.NewMyOFB(block, iv).XORKeyStream, got, msg, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("OFB of %d bytes in %v differs", len(msg), pieces)
+		}
+	})
+}
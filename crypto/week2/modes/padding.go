@@ -0,0 +1,175 @@
+package modes
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+)
+
+// Padding fills a message up to a whole number of blocks for CBC and
+// strips the filling again after decryption.
+type Padding interface {
+	// Pad returns src, a whole message or just its last partial block,
+	// followed by padding up to a multiple of blockSize. It may reuse the
+	// capacity of src.
+	Pad(src []byte, blockSize int) []byte
+	// Unpad checks the padding at the end of src, a whole number of
+	// blocks, and returns src without it.
+	Unpad(src []byte, blockSize int) ([]byte, error)
+}
+
+var (
+	// PKCS7Padding adds n bytes of value n (RFC 5652), always at least one.
+	PKCS7Padding Padding = pkcs7Padding{}
+	// ANSIX923Padding adds n-1 zero bytes and then the byte n.
+	ANSIX923Padding Padding = lengthPadding{filler: 0}
+	// ISO10126Padding adds n-1 random bytes and then the byte n.
+	ISO10126Padding Padding = lengthPadding{filler: -1}
+	// ISO7816Padding adds the byte 0x80 and then zero bytes, as smart
+	// cards do (ISO/IEC 7816-4, also ISO/IEC 9797-1 method 2).
+	ISO7816Padding Padding = iso7816Padding{}
+	// ZeroPadding adds zero bytes, none if the message is block aligned.
+	// Unpad can't tell them from trailing zeros of the message, so it is
+	// only fit for data that never ends in a zero byte.
+	ZeroPadding Padding = zeroPadding{}
+)
+
+type pkcs7Padding struct{}
+
+func (pkcs7Padding) Pad(src []byte, blockSize int) []byte {
+	checkLengthBlockSize(blockSize)
+	paddingSize := blockSize - len(src)%blockSize
+	for k := 0; k < paddingSize; k++ {
+		src = append(src, (byte)(paddingSize))
+	}
+
+	return src
+}
+
+// Unpad takes the same time whatever the padding bytes are, so it can't be
+// used as a padding oracle.
+func (pkcs7Padding) Unpad(src []byte, blockSize int) ([]byte, error) {
+	return unpadLength(src, blockSize, func(b byte, paddingSize int) int {
+		return subtle.ConstantTimeByteEq(b, byte(paddingSize))
+	})
+}
+
+// lengthPadding is a padding whose last byte holds its length and whose
+// other bytes are filler, or random bytes if filler is negative.
+type lengthPadding struct {
+	filler int
+}
+
+func (p lengthPadding) Pad(src []byte, blockSize int) []byte {
+	checkLengthBlockSize(blockSize)
+	paddingSize := blockSize - len(src)%blockSize
+	start := len(src)
+	for k := 0; k < paddingSize-1; k++ {
+		src = append(src, byte(p.filler))
+	}
+	if p.filler < 0 {
+		if _, err := rand.Read(src[start:]); err != nil {
+			panic("modes: reading random padding failed: " + err.Error())
+		}
+	}
+
+	return append(src, (byte)(paddingSize))
+}
+
+func (p lengthPadding) Unpad(src []byte, blockSize int) ([]byte, error) {
+	return unpadLength(src, blockSize, func(b byte, paddingSize int) int {
+		if p.filler < 0 {
+			return 1
+		}
+		return subtle.ConstantTimeByteEq(b, byte(p.filler))
+	})
+}
+
+// checkLengthBlockSize panics if the padding length can't be stored in the
+// last byte, i.e. for blocks longer than 255 bytes.
+func checkLengthBlockSize(blockSize int) {
+	if blockSize < 1 || blockSize > 255 {
+		panic("modes: block size out of range for a length byte padding")
+	}
+}
+
+// unpadLength strips a padding whose last byte is its length, checking the
+// bytes before it with filler, which returns 1 for a good byte. It takes
+// the same time whatever the padding bytes are.
+func unpadLength(src []byte, blockSize int, filler func(b byte, paddingSize int) int) ([]byte, error) {
+	if len(src) < blockSize || len(src)%blockSize != 0 {
+		return nil, ErrShortCiphertext
+	}
+
+	last := src[len(src)-blockSize:]
+	paddingSize := int(last[blockSize-1])
+
+	good := subtle.ConstantTimeLessOrEq(1, paddingSize) & subtle.ConstantTimeLessOrEq(paddingSize, blockSize)
+	for k := 0; k < blockSize-1; k++ {
+		// every byte inside the padding must be filler
+		inPadding := subtle.ConstantTimeLessOrEq(blockSize-k, paddingSize)
+		good &= subtle.ConstantTimeSelect(inPadding, filler(last[k], paddingSize), 1)
+	}
+
+	if good != 1 {
+		return nil, ErrInvalidPadding
+	}
+
+	return src[:len(src)-paddingSize], nil
+}
+
+type iso7816Padding struct{}
+
+func (iso7816Padding) Pad(src []byte, blockSize int) []byte {
+	src = append(src, 0x80)
+	for len(src)%blockSize != 0 {
+		src = append(src, 0)
+	}
+
+	return src
+}
+
+// Unpad looks for the 0x80 marker in the last block in constant time.
+func (iso7816Padding) Unpad(src []byte, blockSize int) ([]byte, error) {
+	if len(src) < blockSize || len(src)%blockSize != 0 {
+		return nil, ErrShortCiphertext
+	}
+
+	last := src[len(src)-blockSize:]
+	seen, good, marker := 0, 0, 0
+	for k := blockSize - 1; k >= 0; k-- {
+		// the first non-zero byte from the end must be the marker
+		first := (seen ^ 1) & (subtle.ConstantTimeByteEq(last[k], 0) ^ 1)
+		good |= first & subtle.ConstantTimeByteEq(last[k], 0x80)
+		marker = subtle.ConstantTimeSelect(first, k, marker)
+		seen |= first
+	}
+
+	if good != 1 {
+		return nil, ErrInvalidPadding
+	}
+
+	return src[:len(src)-blockSize+marker], nil
+}
+
+type zeroPadding struct{}
+
+func (zeroPadding) Pad(src []byte, blockSize int) []byte {
+	for len(src)%blockSize != 0 {
+		src = append(src, 0)
+	}
+
+	return src
+}
+
+func (zeroPadding) Unpad(src []byte, blockSize int) ([]byte, error) {
+	if len(src)%blockSize != 0 {
+		return nil, ErrShortCiphertext
+	}
+
+	n := len(src)
+	for n > len(src)-blockSize && n > 0 && src[n-1] == 0 {
+		n--
+	}
+
+	return src[:n], nil
+}
@@ -0,0 +1,67 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var paddings = []struct {
+	name    string
+	padding modes.Padding
+	// padded is "abc" padded to an 8-byte block, "" if it is random
+	padded string
+	// bad is a block whose padding must be rejected
+	bad string
+}{
+	{"PKCS#7", modes.PKCS7Padding, "6162630505050505", "6162630505050405"},
+	{"ANSI X.923", modes.ANSIX923Padding, "6162630000000005", "6162630000010005"},
+	{"ISO 10126", modes.ISO10126Padding, "", "6162630000000009"},
+	{"ISO/IEC 7816-4", modes.ISO7816Padding, "6162638000000000", "6162630000000000"},
+	{"zero", modes.ZeroPadding, "6162630000000000", ""},
+}
+
+func TestPaddings(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+
+	for _, p := range paddings {
+		padded := p.padding.Pad([]byte("abc"), 8)
+		if p.padded != "" && !bytes.Equal(padded, testutil.Unhex(p.padded)) {
+			t.Fatalf("%s: padded to %x, want %s", p.name, padded, p.padded)
+		}
+		if p.padded == "" && (len(padded) != 8 || padded[7] != 5) {
+			t.Fatalf("%s: padded to %x", p.name, padded)
+		}
+		if p.bad != "" {
+			if _, err := p.padding.Unpad(testutil.Unhex(p.bad), 8); err != modes.ErrInvalidPadding {
+				t.Fatalf("%s: accepted %s: %v", p.name, p.bad, err)
+			}
+		}
+
+		for n := 0; n < 3*aes.BlockSize; n++ {
+			message := make([]byte, n)
+			if _, err := rand.Read(message); err != nil {
+				t.Fatal(err)
+			}
+			if p.padding == modes.ZeroPadding && n > 0 {
+				message[n-1] |= 1
+			}
+
+			enc := modes.NewMyCBCEncrypterWithPadding(block, iv, p.padding)
+			sealed := enc.Encrypt(make([]byte, enc.EncryptedSize(n)), message)
+			dec := modes.NewMyCBCDecrypterWithPadding(block, iv, p.padding)
+			opened, err := dec.Decrypt(make([]byte, len(sealed)), sealed)
+			if err != nil || !bytes.Equal(opened, message) {
+				t.Fatalf("%s: %d byte round trip failed: %v", p.name, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package modes
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallelMinBlocks is the least number of blocks worth handing to a
+// goroutine; smaller inputs are processed serially.
+const parallelMinBlocks = 1024
+
+// splitBlocks divides n blocks into at most workers contiguous chunks and
+// returns the first block of each chunk followed by n.
+func splitBlocks(n, workers int) []int {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if max := n / parallelMinBlocks; workers > max {
+		workers = max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	bounds := make([]int, workers+1)
+	for w := 0; w <= workers; w++ {
+		bounds[w] = n * w / workers
+	}
+
+	return bounds
+}
+
+// XORKeyStreamParallel does the same as XORKeyStream, but spreads the whole
+// blocks of large inputs over workers goroutines, or GOMAXPROCS of them if
+// workers <= 0. The cipher.Block must be safe for concurrent use, as the
+// crypto/aes one is.
+func (ctr *MyCTR) XORKeyStreamParallel(dst, src []byte, workers int) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+	if err := ctr.CheckLength(len(src)); err != nil {
+		panic(err.Error())
+	}
+
+	// use up the buffered key stream first, so the rest starts on ctr.ctr
+	head := len(ctr.out) - ctr.used
+	if head > len(src) {
+		head = len(src)
+	}
+	ctr.XORKeyStream(dst[:head], src[:head])
+	dst = dst[head:]
+	src = src[head:]
+
+	blockSize := len(ctr.out)
+	blocks := len(src) / blockSize
+	bounds := splitBlocks(blocks, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w+1 < len(bounds); w++ {
+		from, to := bounds[w]*blockSize, bounds[w+1]*blockSize
+		counter := make([]byte, blockSize)
+		addCounter(counter, ctr.ctr, uint64(bounds[w]), ctr.counterSize)
+
+		wg.Add(1)
+		go func(dst, src, counter []byte) {
+			defer wg.Done()
+			ctr.xorBlocks(dst, src, counter, 0)
+		}(dst[from:to], src[from:to], counter)
+	}
+	wg.Wait()
+
+	full := blocks * blockSize
+	addCounter(ctr.ctr, ctr.ctr, uint64(blocks), ctr.counterSize)
+	ctr.left -= uint64(blocks)
+	ctr.pos += int64(full)
+
+	ctr.XORKeyStream(dst[full:], src[full:])
+}
+
+// CryptBlocksParallel does the same as CryptBlocks, but spreads large
+// inputs over workers goroutines, or GOMAXPROCS of them if workers <= 0.
+// The cipher.Block must be safe for concurrent use, as the crypto/aes one
+// is.
+func (dec *MyCBCDecrypter) CryptBlocksParallel(dst, src []byte, workers int) {
+	blockSize := dec.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	blocks := len(src) / blockSize
+	bounds := splitBlocks(blocks, workers)
+	if len(bounds) <= 2 {
+		dec.CryptBlocks(dst, src)
+		return
+	}
+
+	// Every chunk chains from the ciphertext block before it. Copy those
+	// first, as dst may overwrite src.
+	chains := make([][]byte, len(bounds))
+	chains[0] = dup(dec.chain)
+	for w := 1; w < len(bounds); w++ {
+		chains[w] = dup(src[(bounds[w]-1)*blockSize : bounds[w]*blockSize])
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w+1 < len(bounds); w++ {
+		from, to := bounds[w]*blockSize, bounds[w+1]*blockSize
+		part := &MyCBCDecrypter{
+			block: dec.block,
+			chain: chains[w],
+			next:  make([]byte, blockSize),
+			tmp:   make([]byte, blockSize),
+		}
+
+		wg.Add(1)
+		go func(dst, src []byte) {
+			defer wg.Done()
+			part.CryptBlocks(dst, src)
+		}(dst[from:to], src[from:to])
+	}
+	wg.Wait()
+
+	copy(dec.chain, chains[len(chains)-1])
+}
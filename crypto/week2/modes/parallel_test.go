@@ -0,0 +1,157 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// parallelBlocks are input sizes in blocks around the 1024 blocks a worker
+// gets at least, and parallelWorkers worker counts, 0 being GOMAXPROCS.
+var (
+	parallelBlocks  = []int{0, 1, 1023, 1024, 2048, 4099, 10000}
+	parallelWorkers = []int{0, 1, 2, 3, 7, 100000}
+)
+
+// parallelInput returns n bytes of a message that is not all the same.
+func parallelInput(n int) []byte {
+	msg := make([]byte, n)
+	for k := range msg {
+		msg[k] = byte(k * 7)
+	}
+
+	return msg
+}
+
+func TestCryptBlocksParallel(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCBCIV)
+
+	for _, blocks := range parallelBlocks {
+		src := parallelInput(blocks * aes.BlockSize)
+		want := make([]byte, len(src))
+		modes.NewMyCBCDecrypter(block, iv).CryptBlocks(want, src)
+
+		for _, workers := range parallelWorkers {
+			got := make([]byte, len(src))
+			modes.NewMyCBCDecrypter(block, iv).CryptBlocksParallel(got, src, workers)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d blocks, %d workers: differs from CryptBlocks", blocks, workers)
+			}
+
+			inPlace := append([]byte(nil), src...)
+			modes.NewMyCBCDecrypter(block, iv).CryptBlocksParallel(inPlace, inPlace, workers)
+			if !bytes.Equal(inPlace, want) {
+				t.Errorf("%d blocks, %d workers: in place differs from CryptBlocks", blocks, workers)
+			}
+
+			// the chain carries over to the next call, parallel or not
+			half := blocks / 2 * aes.BlockSize
+			dec := modes.NewMyCBCDecrypter(block, iv)
+			dec.CryptBlocksParallel(got[:half], src[:half], workers)
+			dec.CryptBlocks(got[half:], src[half:])
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d blocks, %d workers: split at %d differs from CryptBlocks", blocks, workers, half)
+			}
+		}
+	}
+}
+
+func TestXORKeyStreamParallel(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCTRIV)
+
+	for _, blocks := range parallelBlocks {
+		// a stream already 5 bytes into its first block, and a message
+		// that doesn't end on a block boundary either
+		const skip = 5
+		src := parallelInput(skip + blocks*aes.BlockSize + 7)
+		want := make([]byte, len(src))
+		cipher.NewCTR(block, iv).XORKeyStream(want, src)
+
+		for _, workers := range parallelWorkers {
+			got := make([]byte, len(src))
+			ctr := modes.NewMyCTR(block, iv)
+			ctr.XORKeyStream(got[:skip], src[:skip])
+			ctr.XORKeyStreamParallel(got[skip:], src[skip:], workers)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d blocks, %d workers: differs from crypto/cipher", blocks, workers)
+			}
+
+			inPlace := append([]byte(nil), src...)
+			ctr = modes.NewMyCTR(block, iv)
+			ctr.XORKeyStream(inPlace[:skip], inPlace[:skip])
+			ctr.XORKeyStreamParallel(inPlace[skip:len(src)-7], inPlace[skip:len(src)-7], workers)
+			// and the serial stream carries on where the parallel one stopped
+			ctr.XORKeyStream(inPlace[len(src)-7:], inPlace[len(src)-7:])
+			if !bytes.Equal(inPlace, want) {
+				t.Errorf("%d blocks, %d workers: in place differs from crypto/cipher", blocks, workers)
+			}
+		}
+	}
+}
+
+// benchSize is the size of the buffers the benchmarks encrypt.
+const benchSize = 16 << 20
+
+type benchCase struct {
+	name string
+	run  func(b cipher.Block, iv, buf []byte)
+}
+
+// benchmarkCases runs each case over one buffer in place.
+func benchmarkCases(b *testing.B, cases []benchCase) {
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		b.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	buf := make([]byte, benchSize)
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(benchSize)
+			for i := 0; i < b.N; i++ {
+				c.run(block, iv, buf)
+			}
+		})
+	}
+}
+
+func BenchmarkCTR(b *testing.B) {
+	benchmarkCases(b, []benchCase{
+		{"crypto-cipher", func(b cipher.Block, iv, buf []byte) {
+			cipher.NewCTR(b, iv).XORKeyStream(buf, buf)
+		}},
+		{"serial", func(b cipher.Block, iv, buf []byte) {
+			modes.NewMyCTR(b, iv).XORKeyStream(buf, buf)
+		}},
+		{"parallel", func(b cipher.Block, iv, buf []byte) {
+			modes.NewMyCTR(b, iv).XORKeyStreamParallel(buf, buf, 0)
+		}},
+	})
+}
+
+func BenchmarkCBCDecrypt(b *testing.B) {
+	benchmarkCases(b, []benchCase{
+		{"crypto-cipher", func(b cipher.Block, iv, buf []byte) {
+			cipher.NewCBCDecrypter(b, iv).CryptBlocks(buf, buf)
+		}},
+		{"serial", func(b cipher.Block, iv, buf []byte) {
+			modes.NewMyCBCDecrypter(b, iv).CryptBlocks(buf, buf)
+		}},
+		{"parallel", func(b cipher.Block, iv, buf []byte) {
+			modes.NewMyCBCDecrypter(b, iv).CryptBlocksParallel(buf, buf, 0)
+		}},
+	})
+}
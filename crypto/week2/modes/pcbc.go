@@ -0,0 +1,155 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// MyPCBCEncrypter is propagating CBC, as in Kerberos 4 and WASTE: every
+// plaintext block is XORed with both the previous plaintext and the
+// previous ciphertext block before it is encrypted, so a changed
+// ciphertext block garbles the whole rest of the message.
+type MyPCBCEncrypter struct {
+	iv      []byte
+	block   cipher.Block
+	padding Padding
+	// chain holds the previous plaintext XOR ciphertext block, starting
+	// from iv.
+	chain []byte
+	tmp   []byte
+}
+
+// BlockSize returns the mode's block size.
+func (enc *MyPCBCEncrypter) BlockSize() int {
+	return enc.block.BlockSize()
+}
+
+// EncryptedSize returns how long Encrypt's output for srcLen bytes can be.
+func (enc *MyPCBCEncrypter) EncryptedSize(srcLen int) int {
+	// source len + iv len + padding len
+	return srcLen + enc.BlockSize() + enc.BlockSize() - srcLen%enc.BlockSize()
+}
+
+// CryptBlocks encrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+// The chaining value is kept between calls.
+func (enc *MyPCBCEncrypter) CryptBlocks(dst, src []byte) {
+	blockSize := enc.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		xorSlice(enc.tmp, src[i:i+blockSize], enc.chain)
+		// keep the plaintext block, dst may overwrite it
+		copy(enc.chain, src[i:i+blockSize])
+		enc.block.Encrypt(dst[i:i+blockSize], enc.tmp)
+		xorSlice(enc.chain, enc.chain, dst[i:i+blockSize])
+	}
+}
+
+// Encrypt pads src, encrypts it from the IV the encrypter was created with
+// and writes iv||ciphertext to dst, returning the written part of dst.
+// len(dst) must be at least EncryptedSize(len(src)).
+func (enc *MyPCBCEncrypter) Encrypt(dst, src []byte) []byte {
+	if len(dst) < enc.EncryptedSize(len(src)) {
+		panic("len(dst) < enc.EncryptedSize(len(src))")
+	}
+
+	copy(enc.chain, enc.iv)
+	return encryptPadded(dst, enc.iv, src, enc, enc.padding)
+}
+
+func NewMyPCBCEncrypter(b cipher.Block, iv []byte) *MyPCBCEncrypter {
+	return NewMyPCBCEncrypterWithPadding(b, iv, PKCS7Padding)
+}
+
+// NewMyPCBCEncrypterWithPadding returns a MyPCBCEncrypter whose Encrypt
+// uses the given padding instead of PKCS#7.
+func NewMyPCBCEncrypterWithPadding(b cipher.Block, iv []byte, padding Padding) *MyPCBCEncrypter {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	return &MyPCBCEncrypter{
+		iv:      dup(iv),
+		block:   b,
+		padding: padding,
+		chain:   dup(iv),
+		tmp:     make([]byte, b.BlockSize()),
+	}
+}
+
+type MyPCBCDecrypter struct {
+	block   cipher.Block
+	padding Padding
+	// chain holds the previous plaintext XOR ciphertext block, starting
+	// from iv.
+	chain []byte
+	next  []byte
+	tmp   []byte
+}
+
+// BlockSize returns the mode's block size.
+func (dec *MyPCBCDecrypter) BlockSize() int {
+	return dec.block.BlockSize()
+}
+
+// CryptBlocks decrypts a number of blocks. The length of src must be a
+// multiple of the block size. Dst and src may point to the same memory.
+func (dec *MyPCBCDecrypter) CryptBlocks(dst, src []byte) {
+	blockSize := dec.BlockSize()
+	if len(src)%blockSize != 0 {
+		panic("src must be a multiple of the block size.")
+	}
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	for i := 0; i < len(src); i += blockSize {
+		// keep the ciphertext block, dst may overwrite it
+		copy(dec.next, src[i:i+blockSize])
+		dec.block.Decrypt(dec.tmp, dec.next)
+		xorSlice(dst[i:i+blockSize], dec.tmp, dec.chain)
+		xorSlice(dec.chain, dst[i:i+blockSize], dec.next)
+	}
+}
+
+// Decrypt decrypts iv||ciphertext as written by MyPCBCEncrypter.Encrypt,
+// taking the IV from the first block of src, and returns the plaintext
+// with the padding removed. len(dst) must be at least len(src).
+func (dec *MyPCBCDecrypter) Decrypt(dst, src []byte) ([]byte, error) {
+	if len(dst) < len(src) {
+		panic("len(dst) < len(src)")
+	}
+
+	blockSize := dec.BlockSize()
+	if len(src) < blockSize {
+		return nil, ErrShortCiphertext
+	}
+
+	copy(dec.chain, src[:blockSize])
+	return decryptPadded(dst, src[blockSize:], dec, dec.padding)
+}
+
+func NewMyPCBCDecrypter(b cipher.Block, iv []byte) *MyPCBCDecrypter {
+	return NewMyPCBCDecrypterWithPadding(b, iv, PKCS7Padding)
+}
+
+// NewMyPCBCDecrypterWithPadding returns a MyPCBCDecrypter whose Decrypt
+// expects the given padding instead of PKCS#7.
+func NewMyPCBCDecrypterWithPadding(b cipher.Block, iv []byte, padding Padding) *MyPCBCDecrypter {
+	if len(iv) != b.BlockSize() {
+		return nil
+	}
+
+	return &MyPCBCDecrypter{
+		block:   b,
+		padding: padding,
+		chain:   dup(iv),
+		next:    make([]byte, b.BlockSize()),
+		tmp:     make([]byte, b.BlockSize()),
+	}
+}
@@ -0,0 +1,54 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// FuzzPCBC compares PCBC with its definition, there being no PCBC in
+// crypto/cipher or in SP 800-38A, feeding the message in the pieces cuts
+// cuts it into.
+func FuzzPCBC(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, key, iv, msg, cuts []byte) {
+		block, err := aes.NewCipher(key)
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Skip()
+		}
+		msg = msg[:len(msg)-len(msg)%aes.BlockSize]
+		pieces := fuzzPieces(len(msg), aes.BlockSize, cuts)
+
+		want := make([]byte, len(msg))
+		chain := append([]byte(nil), iv...)
+		for k := 0; k < len(msg); k += aes.BlockSize {
+			p, c := msg[k:k+aes.BlockSize], want[k:k+aes.BlockSize]
+			for i := range chain {
+				chain[i] ^= p[i]
+			}
+			block.Encrypt(c, chain)
+			for i := range chain {
+				chain[i] = p[i] ^ c[i]
+			}
+		}
+
+		got := make([]byte, len(msg))
+		feed(modes.NewMyPCBCEncrypter(block, iv).CryptBlocks, got, msg, pieces)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("encrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+		feed(modes.NewMyPCBCDecrypter(block, iv).CryptBlocks, got, got, pieces)
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("decrypt of %d bytes in %v differs", len(msg), pieces)
+		}
+
+		enc := modes.NewMyPCBCEncrypter(block, iv)
+		wire := enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg)
+		plain, err := modes.NewMyPCBCDecrypter(block, iv).Decrypt(make([]byte, len(wire)), wire)
+		if err != nil || !bytes.Equal(plain, msg) {
+			t.Fatalf("Encrypt of %d bytes doesn't round trip: %v", len(msg), err)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package modes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/sliceutil"
+)
+
+const (
+	sivSize = 16
+	// sivMaxComponents is the most associated data components plus the
+	// plaintext that S2V takes.
+	sivMaxComponents = 127
+)
+
+// ErrSIVKeySize is returned by NewAESSIV for a key that is not 32, 48 or 64
+// bytes long.
+var ErrSIVKeySize = errors.New("modes: AES-SIV key must be 32, 48 or 64 bytes")
+
+// MySIV is SIV mode (RFC 5297), deterministic authenticated encryption:
+// the synthetic IV is a CMAC-based PRF (S2V) of the associated data and
+// the plaintext, and it is both the tag and the IV of CTR mode. Sealing
+// the same plaintext with the same associated data gives the same
+// ciphertext, which is all an attacker learns; a nonce can be added as
+// one of the associated data components to make every message distinct.
+type MySIV struct {
+	mac *MyCMAC
+	ctr cipher.Block
+}
+
+// NewMySIV returns SIV with mac for S2V and ctr for the encryption, two
+// 16-byte block ciphers under different keys.
+func NewMySIV(mac, ctr cipher.Block) *MySIV {
+	if mac.BlockSize() != sivSize || ctr.BlockSize() != sivSize {
+		return nil
+	}
+
+	return &MySIV{
+		mac: NewMyCMAC(mac),
+		ctr: ctr,
+	}
+}
+
+// NewAESSIV returns AES-SIV for a 32, 48 or 64 byte key, the first half
+// being the S2V key and the second the CTR key.
+func NewAESSIV(key []byte) (*MySIV, error) {
+	if len(key) != 32 && len(key) != 48 && len(key) != 64 {
+		return nil, ErrSIVKeySize
+	}
+
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMySIV(mac, ctr), nil
+}
+
+// Overhead returns the size of the synthetic IV.
+func (s *MySIV) Overhead() int {
+	return sivSize
+}
+
+// Seal appends V||ciphertext of plaintext to dst, V being the synthetic IV
+// of the associated data components ad and plaintext. It panics for more
+// than 126 components.
+func (s *MySIV) Seal(dst, plaintext []byte, ad ...[]byte) []byte {
+	if len(ad) >= sivMaxComponents {
+		panic("modes: too many associated data components for SIV")
+	}
+
+	v := s.s2v(ad, plaintext)
+	ret, out := sliceutil.ForAppend(dst, sivSize+len(plaintext))
+	copy(out, v)
+	s.counterStream(v).XORKeyStream(out[sivSize:], plaintext)
+
+	return ret
+}
+
+// Open decrypts and authenticates V||ciphertext as written by Seal with the
+// same associated data components and appends the plaintext to dst.
+func (s *MySIV) Open(dst, ciphertext []byte, ad ...[]byte) ([]byte, error) {
+	if len(ciphertext) < sivSize || len(ad) >= sivMaxComponents {
+		return nil, errOpen
+	}
+
+	v := ciphertext[:sivSize]
+	plaintext := make([]byte, len(ciphertext)-sivSize)
+	s.counterStream(v).XORKeyStream(plaintext, ciphertext[sivSize:])
+
+	if subtle.ConstantTimeCompare(s.s2v(ad, plaintext), v) != 1 {
+		for k := range plaintext {
+			plaintext[k] = 0
+		}
+		return nil, errOpen
+	}
+
+	return append(dst, plaintext...), nil
+}
+
+// counterStream returns the CTR stream starting at v with the bits 63 and
+// 31 cleared, so that a 32-bit implementation can't carry between the
+// words. The counter then runs over the whole block.
+func (s *MySIV) counterStream(v []byte) *MyCTR {
+	q := dup(v)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+
+	return NewMyCTRWithCounter(s.ctr, q, sivSize)
+}
+
+// s2v is the S2V PRF of RFC 5297 section 2.4 over the components ad and
+// the plaintext, which always comes last.
+func (s *MySIV) s2v(ad [][]byte, plaintext []byte) []byte {
+	d := s.cmac(make([]byte, sivSize))
+	for _, a := range ad {
+		d = gfDouble(d)
+		xorSlice(d, d, s.cmac(a))
+	}
+
+	var t []byte
+	if len(plaintext) >= sivSize {
+		// xorend: d goes into the last block of the plaintext
+		t = dup(plaintext)
+		end := t[len(t)-sivSize:]
+		xorSlice(end, end, d)
+	} else {
+		t = gfDouble(d)
+		xorSlice(t, t, cmacPad(plaintext, sivSize))
+	}
+
+	return s.cmac(t)
+}
+
+// cmac returns the CMAC of msg from a fresh copy of the MAC, so that a
+// MySIV can be used concurrently.
+func (s *MySIV) cmac(msg []byte) []byte {
+	m := s.mac.clone()
+	m.Write(msg)
+	return m.Sum(nil)
+}
+
+// cmacPad returns b followed by 0x80 and zeros up to size bytes.
+func cmacPad(b []byte, size int) []byte {
+	p := make([]byte, size)
+	copy(p, b)
+	p[len(b)] = 0x80
+
+	return p
+}
@@ -0,0 +1,118 @@
+package modes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// sivVectors are the examples of RFC 5297 appendix A; the second one has
+// two associated data components and a nonce as the third.
+var sivVectors = []struct {
+	name       string
+	key        string
+	ad         []string
+	plaintext  string
+	ciphertext string
+}{
+	{
+		"A.1 deterministic",
+		"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		[]string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+		"112233445566778899aabbccddee",
+		"85632d07c6e8f37f950acd320a2ecc93 40c02b9690c4dc04daef7f6afe5c",
+	},
+	{
+		"A.2 nonce-based",
+		"7f7e7d7c7b7a79787776757473727170 404142434445464748494a4b4c4d4e4f",
+		[]string{
+			"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+			"102030405060708090a0",
+			"09f911029d74e35bd84156c5635688c0",
+		},
+		"7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+		"7bdb6e3b432667eb06f4d14bff2fbd0f cb900f2fddbe404326601965c889bf17 dba77ceb094fa663b7a3f748ba8af829 ea64ad544a272e9c485b62a3fd5c0d",
+	},
+}
+
+func TestSIVVectors(t *testing.T) {
+	for _, v := range sivVectors {
+		siv, err := modes.NewAESSIV(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ad [][]byte
+		for _, a := range v.ad {
+			ad = append(ad, testutil.Unhex(a))
+		}
+		pt, want := testutil.Unhex(v.plaintext), testutil.Unhex(v.ciphertext)
+
+		got := siv.Seal(nil, pt, ad...)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: Seal got %x, want %x", v.name, got, want)
+		}
+		plain, err := siv.Open(nil, want, ad...)
+		if err != nil {
+			t.Fatalf("%s: Open failed with: %v", v.name, err)
+		}
+		if !bytes.Equal(plain, pt) {
+			t.Fatalf("%s: Open got %x, want %x", v.name, plain, pt)
+		}
+
+		// any change to the ciphertext or the components must be caught,
+		// including their order
+		for k := range want {
+			bad := append([]byte(nil), want...)
+			bad[k] ^= 1
+			if _, err := siv.Open(nil, bad, ad...); err == nil {
+				t.Fatalf("%s: Open accepted byte %d changed", v.name, k)
+			}
+		}
+		if _, err := siv.Open(nil, want, append(ad, nil)...); err == nil {
+			t.Fatalf("%s: Open accepted an extra empty component", v.name)
+		}
+		if len(ad) > 1 {
+			swapped := append([][]byte{ad[1], ad[0]}, ad[2:]...)
+			if _, err := siv.Open(nil, want, swapped...); err == nil {
+				t.Fatalf("%s: Open accepted swapped components", v.name)
+			}
+		}
+	}
+}
+
+// TestSIVNonceReuse shows what a repeated nonce gives away under SIV:
+// whether two messages are equal, and nothing else. The same nonce under
+// CTR gives away the XOR of the messages.
+func TestSIVNonceReuse(t *testing.T) {
+	siv, err := modes.NewAESSIV(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("the same nonce!!")
+
+	a := siv.Seal(nil, []byte("attack at dawn"), nonce)
+	b := siv.Seal(nil, []byte("attack at dawn"), nonce)
+	c := siv.Seal(nil, []byte("attack at dusk"), nonce)
+	if !bytes.Equal(a, b) {
+		t.Fatalf("equal messages under one nonce give different ciphertexts")
+	}
+
+	// the messages differ only in their last bytes, the ciphertexts all
+	// over: a different SIV is a different key stream
+	same := 0
+	for k := range a {
+		if a[k] == c[k] {
+			same++
+		}
+	}
+	if same > 4 {
+		t.Fatalf("different messages share %d ciphertext bytes", same)
+	}
+
+	// leave the nonce out for plain deterministic encryption
+	if bytes.Equal(siv.Seal(nil, []byte("attack at dawn")), a) {
+		t.Fatalf("the nonce component made no difference")
+	}
+}
@@ -0,0 +1,352 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// streamChunkSize is how much data the stream wrappers process at once.
+const streamChunkSize = 32 * 1024
+
+// maxConsecutiveEmptyReads is how many reads returning neither data nor an
+// error a reader puts up with before giving up with io.ErrNoProgress, as
+// bufio does.
+const maxConsecutiveEmptyReads = 100
+
+var errWriterClosed = errors.New("modes: write to closed writer")
+
+type cbcEncryptWriter struct {
+	w   io.Writer
+	enc *MyCBCEncrypter
+	// pending holds the last partial block until more data or Close.
+	pending  []byte
+	npending int
+	out      []byte
+	wroteIV  bool
+	err      error
+}
+
+// NewCBCEncryptWriter returns a writer that CBC encrypts everything written
+// to it and writes iv||ciphertext to w, in the same format as
+// MyCBCEncrypter.Encrypt. Close must be called to write the padded last
+// block; it does not close w.
+func NewCBCEncryptWriter(w io.Writer, b cipher.Block, iv []byte) io.WriteCloser {
+	enc := NewMyCBCEncrypter(b, iv)
+	if enc == nil {
+		return nil
+	}
+
+	return &cbcEncryptWriter{
+		w:       w,
+		enc:     enc,
+		pending: make([]byte, b.BlockSize()),
+		out:     make([]byte, streamChunkSize),
+	}
+}
+
+func (cw *cbcEncryptWriter) flush(p []byte) error {
+	if !cw.wroteIV {
+		cw.wroteIV = true
+		if _, err := cw.w.Write(cw.enc.iv); err != nil {
+			return err
+		}
+	}
+
+	_, err := cw.w.Write(p)
+	return err
+}
+
+func (cw *cbcEncryptWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	blockSize := cw.enc.BlockSize()
+	written := 0
+	for len(p) > 0 {
+		if cw.npending > 0 || len(p) < blockSize {
+			k := copy(cw.pending[cw.npending:], p)
+			cw.npending += k
+			p = p[k:]
+			written += k
+			if cw.npending < blockSize {
+				break
+			}
+
+			cw.enc.CryptBlocks(cw.out[:blockSize], cw.pending)
+			cw.npending = 0
+			if cw.err = cw.flush(cw.out[:blockSize]); cw.err != nil {
+				return written, cw.err
+			}
+			continue
+		}
+
+		k := len(p) - len(p)%blockSize
+		if k > len(cw.out) {
+			k = len(cw.out)
+		}
+		cw.enc.CryptBlocks(cw.out[:k], p[:k])
+		p = p[k:]
+		written += k
+		if cw.err = cw.flush(cw.out[:k]); cw.err != nil {
+			return written, cw.err
+		}
+	}
+
+	return written, nil
+}
+
+// Close pads and writes the last block.
+func (cw *cbcEncryptWriter) Close() error {
+	if cw.err != nil {
+		if cw.err == errWriterClosed {
+			return nil
+		}
+		return cw.err
+	}
+
+	blockSize := cw.enc.BlockSize()
+	padded := cw.enc.padding.Pad(cw.pending[:cw.npending], blockSize)
+	cw.enc.CryptBlocks(cw.out[:len(padded)], padded)
+	if cw.err = cw.flush(cw.out[:len(padded)]); cw.err != nil {
+		return cw.err
+	}
+
+	cw.err = errWriterClosed
+	return nil
+}
+
+type cbcDecryptReader struct {
+	r   io.Reader
+	dec *MyCBCDecrypter
+	// in holds ciphertext not decrypted yet. The last whole block is
+	// always kept back until EOF, because it carries the padding.
+	in    []byte
+	nin   int
+	out   []byte
+	ready []byte
+	gotIV bool
+	err   error
+}
+
+// NewCBCDecryptReader returns a reader that decrypts iv||ciphertext, as
+// written by NewCBCEncryptWriter, read from r. The padding is checked and
+// removed when r reaches EOF; a bad padding or a truncated stream is
+// reported by Read as ErrInvalidPadding or ErrShortCiphertext instead of
+// io.EOF.
+func NewCBCDecryptReader(r io.Reader, b cipher.Block) io.Reader {
+	return &cbcDecryptReader{
+		r:   r,
+		dec: NewMyCBCDecrypter(b, make([]byte, b.BlockSize())),
+		in:  make([]byte, streamChunkSize+b.BlockSize()),
+		out: make([]byte, streamChunkSize+b.BlockSize()),
+	}
+}
+
+func (cr *cbcDecryptReader) Read(p []byte) (int, error) {
+	for empty := 0; len(cr.ready) == 0 && cr.err == nil; {
+		if cr.fill() > 0 {
+			empty = 0
+		} else if empty++; empty >= maxConsecutiveEmptyReads {
+			cr.err = io.ErrNoProgress
+		}
+	}
+
+	if len(cr.ready) > 0 {
+		n := copy(p, cr.ready)
+		cr.ready = cr.ready[n:]
+		return n, nil
+	}
+
+	return 0, cr.err
+}
+
+// fill reads the next piece of ciphertext, the IV first, and decrypts what
+// it can. It returns how many bytes it read.
+func (cr *cbcDecryptReader) fill() int {
+	blockSize := cr.dec.BlockSize()
+
+	n, err := cr.r.Read(cr.in[cr.nin:])
+	cr.nin += n
+	if !cr.gotIV {
+		if cr.nin < blockSize {
+			if err != nil {
+				cr.err = shortIfEOF(err)
+			}
+			return n
+		}
+		copy(cr.dec.chain, cr.in[:blockSize])
+		cr.nin = copy(cr.in, cr.in[blockSize:cr.nin])
+		cr.gotIV = true
+	}
+
+	if err == io.EOF {
+		if cr.nin%blockSize != 0 {
+			cr.err = ErrShortCiphertext
+			return n
+		}
+
+		cr.dec.CryptBlocks(cr.out[:cr.nin], cr.in[:cr.nin])
+		cr.ready, cr.err = cr.dec.padding.Unpad(cr.out[:cr.nin], blockSize)
+		if cr.err == nil {
+			cr.err = io.EOF
+		}
+		return n
+	} else if err != nil {
+		cr.err = err
+		return n
+	}
+
+	k := cr.nin - cr.nin%blockSize - blockSize
+	if k <= 0 {
+		return n
+	}
+	cr.dec.CryptBlocks(cr.out[:k], cr.in[:k])
+	cr.nin = copy(cr.in, cr.in[k:cr.nin])
+	cr.ready = cr.out[:k]
+	return n
+}
+
+type ctrReader struct {
+	r     io.Reader
+	ctr   *MyCTR
+	gotIV bool
+}
+
+// NewCTRReader returns a reader that decrypts iv||ciphertext, as written
+// by NewCTRWriter or MyCTR.Encrypt, read from r.
+func NewCTRReader(r io.Reader, b cipher.Block) io.Reader {
+	return &ctrReader{
+		r:   r,
+		ctr: NewMyCTR(b, make([]byte, b.BlockSize())),
+	}
+}
+
+func (cr *ctrReader) Read(p []byte) (int, error) {
+	if !cr.gotIV {
+		iv := make([]byte, cr.ctr.block.BlockSize())
+		if _, err := io.ReadFull(cr.r, iv); err != nil {
+			return 0, shortIfEOF(err)
+		}
+		cr.ctr.reset(iv)
+		cr.gotIV = true
+	}
+
+	n, err := cr.r.Read(p)
+	if cerr := cr.ctr.CheckLength(n); cerr != nil {
+		return 0, cerr
+	}
+	cr.ctr.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+type ctrReaderAt struct {
+	r   io.ReaderAt
+	ctr *MyCTR
+}
+
+// NewCTRReaderAt returns an io.ReaderAt over the plaintext of the
+// iv||ciphertext stored in r. The IV is read once up front, after which
+// every ReadAt only reads and decrypts the bytes asked for.
+func NewCTRReaderAt(r io.ReaderAt, b cipher.Block) (io.ReaderAt, error) {
+	iv := make([]byte, b.BlockSize())
+	if n, err := r.ReadAt(iv, 0); n < len(iv) {
+		return nil, shortIfEOF(err)
+	}
+
+	return &ctrReaderAt{
+		r:   r,
+		ctr: NewMyCTR(b, iv),
+	}, nil
+}
+
+func (cr *ctrReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("modes: negative offset")
+	}
+
+	n, err := cr.r.ReadAt(p, off+int64(len(cr.ctr.iv)))
+	if cerr := cr.ctr.XORKeyStreamAt(p[:n], p[:n], off); cerr != nil {
+		return 0, cerr
+	}
+	return n, err
+}
+
+type ctrWriter struct {
+	w       io.Writer
+	ctr     *MyCTR
+	out     []byte
+	wroteIV bool
+	err     error
+}
+
+// NewCTRWriter returns a writer that CTR encrypts everything written to it
+// and writes iv||ciphertext to w. Close only stops further writes, it does
+// not close w.
+func NewCTRWriter(w io.Writer, b cipher.Block, iv []byte) io.WriteCloser {
+	ctr := NewMyCTR(b, iv)
+	if ctr == nil {
+		return nil
+	}
+
+	return &ctrWriter{
+		w:   w,
+		ctr: ctr,
+		out: make([]byte, streamChunkSize),
+	}
+}
+
+func (cw *ctrWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	if !cw.wroteIV {
+		cw.wroteIV = true
+		if _, cw.err = cw.w.Write(cw.ctr.iv); cw.err != nil {
+			return 0, cw.err
+		}
+	}
+
+	if err := cw.ctr.CheckLength(len(p)); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		k := len(p)
+		if k > len(cw.out) {
+			k = len(cw.out)
+		}
+		cw.ctr.XORKeyStream(cw.out[:k], p[:k])
+		p = p[k:]
+		written += k
+		if _, cw.err = cw.w.Write(cw.out[:k]); cw.err != nil {
+			return written, cw.err
+		}
+	}
+
+	return written, nil
+}
+
+// Close writes the IV if nothing was written yet.
+func (cw *ctrWriter) Close() error {
+	if cw.err == nil && !cw.wroteIV {
+		cw.Write(nil)
+	}
+	if cw.err != nil && cw.err != errWriterClosed {
+		return cw.err
+	}
+
+	cw.err = errWriterClosed
+	return nil
+}
+
+func shortIfEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrShortCiphertext
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package modes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// streamSizes are message sizes around the block size and around the 32 KiB
+// the stream wrappers work in.
+var streamSizes = []int{0, 1, 15, 16, 17, 100, 32<<10 - 1, 32 << 10, 32<<10 + 17, 100000}
+
+// writeByByte writes msg to w a byte at a time and closes it.
+func writeByByte(w io.WriteCloser, msg []byte) error {
+	for k := range msg {
+		if n, err := w.Write(msg[k : k+1]); n != 1 || err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func TestCBCStreamOneByte(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCBCIV)
+
+	for _, size := range streamSizes {
+		msg := bytes.Repeat([]byte{'s'}, size)
+		enc := modes.NewMyCBCEncrypter(block, iv)
+		want := enc.Encrypt(make([]byte, enc.EncryptedSize(size)), msg)
+
+		var buf bytes.Buffer
+		if err := writeByByte(modes.NewCBCEncryptWriter(&buf, block, iv), msg); err != nil {
+			t.Fatalf("%d bytes: write failed with: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%d bytes: writer differs from Encrypt", size)
+		}
+
+		for _, r := range []io.Reader{iotest.OneByteReader(bytes.NewReader(want)), iotest.DataErrReader(bytes.NewReader(want))} {
+			plain, err := ioutil.ReadAll(iotest.OneByteReader(modes.NewCBCDecryptReader(r, block)))
+			if err != nil || !bytes.Equal(plain, msg) {
+				t.Fatalf("%d bytes: read back %d bytes, %v", size, len(plain), err)
+			}
+		}
+	}
+}
+
+func TestCBCDecryptReaderErrors(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCBCIV)
+	enc := modes.NewMyCBCEncrypter(block, iv)
+	wire := enc.Encrypt(make([]byte, enc.EncryptedSize(20)), make([]byte, 20))
+
+	// the plaintext ends in 12 bytes of 0x0c, turn the last one into 0x1c
+	badPadding := append([]byte(nil), wire...)
+	badPadding[len(badPadding)-aes.BlockSize-1] ^= 0x10
+
+	tests := []struct {
+		name string
+		src  []byte
+		want error
+	}{
+		{"empty", nil, modes.ErrShortCiphertext},
+		{"part of the IV", wire[:10], modes.ErrShortCiphertext},
+		{"IV only", wire[:aes.BlockSize], modes.ErrShortCiphertext},
+		{"truncated in a block", wire[:len(wire)-1], modes.ErrShortCiphertext},
+		{"corrupted padding", badPadding, modes.ErrInvalidPadding},
+	}
+	for _, tt := range tests {
+		_, err := ioutil.ReadAll(modes.NewCBCDecryptReader(iotest.OneByteReader(bytes.NewReader(tt.src)), block))
+		if err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// emptyReader returns neither data nor an error, forever.
+type emptyReader struct{}
+
+func (emptyReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestCBCDecryptReaderNoProgress(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := modes.NewCBCDecryptReader(io.MultiReader(bytes.NewReader(make([]byte, 40)), emptyReader{}), block)
+	if _, err := ioutil.ReadAll(r); err != io.ErrNoProgress {
+		t.Errorf("got %v, want io.ErrNoProgress", err)
+	}
+}
+
+func TestCTRStreamOneByte(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCTRIV)
+
+	for _, size := range streamSizes {
+		msg := bytes.Repeat([]byte{'s'}, size)
+		ctr := modes.NewMyCTR(block, iv)
+		want, err := ctr.Encrypt(make([]byte, ctr.EncryptedSize(size)), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := writeByByte(modes.NewCTRWriter(&buf, block, iv), msg); err != nil {
+			t.Fatalf("%d bytes: write failed with: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%d bytes: writer differs from Encrypt", size)
+		}
+
+		plain, err := ioutil.ReadAll(modes.NewCTRReader(iotest.OneByteReader(bytes.NewReader(want)), block))
+		if err != nil || !bytes.Equal(plain, msg) {
+			t.Fatalf("%d bytes: read back %d bytes, %v", size, len(plain), err)
+		}
+	}
+
+	if _, err := ioutil.ReadAll(modes.NewCTRReader(bytes.NewReader(iv[:10]), block)); err != modes.ErrShortCiphertext {
+		t.Errorf("part of the IV: got %v, want ErrShortCiphertext", err)
+	}
+}
+
+func TestCTRReaderAt(t *testing.T) {
+	block, err := aes.NewCipher(testutil.Unhex(sp80038aKeys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := testutil.Unhex(sp80038aCTRIV)
+
+	msg := make([]byte, 1000)
+	for k := range msg {
+		msg[k] = byte(k * 7)
+	}
+	ctr := modes.NewMyCTR(block, iv)
+	wire, err := ctr.Encrypt(make([]byte, ctr.EncryptedSize(len(msg))), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ra, err := modes.NewCTRReaderAt(bytes.NewReader(wire), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int{0, 1, 15, 16, 17, 100, 983} {
+		p := make([]byte, 17)
+		if n, err := ra.ReadAt(p, int64(off)); n != len(p) || err != nil {
+			t.Fatalf("ReadAt %d got %d, %v", off, n, err)
+		}
+		if !bytes.Equal(p, msg[off:off+len(p)]) {
+			t.Errorf("ReadAt %d got %x, want %x", off, p, msg[off:off+len(p)])
+		}
+	}
+
+	// a read past the end returns what there is with io.EOF
+	p := make([]byte, 20)
+	n, err := ra.ReadAt(p, int64(len(msg)-7))
+	if n != 7 || err != io.EOF || !bytes.Equal(p[:n], msg[len(msg)-7:]) {
+		t.Errorf("ReadAt at the end got %d, %v", n, err)
+	}
+	if n, err := ra.ReadAt(p, int64(len(msg))); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt past the end got %d, %v", n, err)
+	}
+	if _, err := ra.ReadAt(p, -1); err == nil {
+		t.Errorf("negative offset accepted")
+	}
+
+	if _, err := modes.NewCTRReaderAt(bytes.NewReader(iv[:10]), block); err != modes.ErrShortCiphertext {
+		t.Errorf("part of the IV: got %v, want ErrShortCiphertext", err)
+	}
+}
@@ -0,0 +1,273 @@
+package modes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const xtsBlockSize = 16
+
+// ErrXTSKeySize is returned by NewXTSAES for a key that is not two AES-128
+// or two AES-256 keys.
+var ErrXTSKeySize = errors.New("modes: XTS-AES key must be 32 or 64 bytes")
+
+// MyXTS is XTS (IEEE 1619), the tweakable mode for storage: every sector
+// is encrypted on its own under a tweak made from its sector number, so
+// any sector can be read or rewritten without touching the others and no
+// IV is stored. A sector whose length is not a multiple of the block size
+// is handled with ciphertext stealing, so sectors keep their size.
+type MyXTS struct {
+	data  cipher.Block
+	tweak cipher.Block
+}
+
+// NewMyXTS returns XTS with the data and the tweak cipher, which must be
+// two 16-byte block ciphers under different keys.
+func NewMyXTS(data, tweak cipher.Block) *MyXTS {
+	if data.BlockSize() != xtsBlockSize || tweak.BlockSize() != xtsBlockSize {
+		return nil
+	}
+
+	return &MyXTS{
+		data:  data,
+		tweak: tweak,
+	}
+}
+
+// NewXTSAES returns XTS-AES-128 or XTS-AES-256 for a 32 or 64 byte key,
+// the first half being the data key and the second the tweak key.
+func NewXTSAES(key []byte) (*MyXTS, error) {
+	if len(key) != 32 && len(key) != 64 {
+		return nil, ErrXTSKeySize
+	}
+
+	data, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	tweak, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMyXTS(data, tweak), nil
+}
+
+// Encrypt encrypts the sector src, at least one block long, into dst,
+// which must be at least as long. Dst and src may point to the same
+// memory.
+func (x *MyXTS) Encrypt(dst, src []byte, sectorNum uint64) error {
+	return x.crypt(dst, src, sectorNum, false)
+}
+
+// Decrypt decrypts the sector src into dst, which must be at least as
+// long. Dst and src may point to the same memory.
+func (x *MyXTS) Decrypt(dst, src []byte, sectorNum uint64) error {
+	return x.crypt(dst, src, sectorNum, true)
+}
+
+func (x *MyXTS) crypt(dst, src []byte, sectorNum uint64, decrypt bool) error {
+	n := len(src)
+	if n < xtsBlockSize {
+		return ErrShortInput
+	}
+	if len(dst) < n {
+		panic("len(dst) < len(src)")
+	}
+
+	// the tweak is the sector number as a little-endian 128-bit number,
+	// encrypted
+	var t, t2 [xtsBlockSize]byte
+	binary.LittleEndian.PutUint64(t[:8], sectorNum)
+	x.tweak.Encrypt(t[:], t[:])
+
+	d := n % xtsBlockSize
+	full := n - d
+	if d != 0 {
+		// the last whole block is left for the stealing
+		full -= xtsBlockSize
+	}
+
+	for i := 0; i < full; i += xtsBlockSize {
+		x.cryptBlock(dst[i:i+xtsBlockSize], src[i:i+xtsBlockSize], &t, decrypt)
+		mulAlpha(&t)
+	}
+	if d == 0 {
+		return nil
+	}
+
+	// the last whole block takes the tail's place and lends it the bytes
+	// it is short of; decryption needs the tweaks the other way round
+	t2 = t
+	mulAlpha(&t2)
+	first, second := &t, &t2
+	if decrypt {
+		first, second = second, first
+	}
+
+	var cc [xtsBlockSize]byte
+	tail := dup(src[full+xtsBlockSize : n])
+	x.cryptBlock(cc[:], src[full:full+xtsBlockSize], first, decrypt)
+	copy(dst[full+xtsBlockSize:n], cc[:d])
+	copy(cc[:d], tail)
+	x.cryptBlock(dst[full:full+xtsBlockSize], cc[:], second, decrypt)
+
+	return nil
+}
+
+func (x *MyXTS) cryptBlock(dst, src []byte, t *[xtsBlockSize]byte, decrypt bool) {
+	var b [xtsBlockSize]byte
+	xorSlice(b[:], src, t[:])
+	if decrypt {
+		x.data.Decrypt(b[:], b[:])
+	} else {
+		x.data.Encrypt(b[:], b[:])
+	}
+	xorSlice(dst, b[:], t[:])
+}
+
+// mulAlpha multiplies the tweak by α in GF(2^128), the bytes taken as a
+// little-endian number.
+func mulAlpha(t *[xtsBlockSize]byte) {
+	carry := t[xtsBlockSize-1] >> 7
+	for k := xtsBlockSize - 1; k > 0; k-- {
+		t[k] = t[k]<<1 | t[k-1]>>7
+	}
+	t[0] = t[0]<<1 ^ 0x87&-carry
+}
+
+// ReadWriterAt is storage that can be read and written at any offset, like
+// an *os.File.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+type xtsVolume struct {
+	r          io.ReaderAt
+	w          io.WriterAt
+	x          *MyXTS
+	sectorSize int64
+}
+
+// NewXTSReaderAt returns an io.ReaderAt over the plaintext of a volume
+// encrypted with x in sectors of sectorSize bytes, sector n starting at
+// byte n*sectorSize and having sector number n. The last sector may be
+// shorter, but not shorter than one block.
+func NewXTSReaderAt(r io.ReaderAt, x *MyXTS, sectorSize int) io.ReaderAt {
+	if sectorSize < xtsBlockSize {
+		return nil
+	}
+
+	return &xtsVolume{r: r, x: x, sectorSize: int64(sectorSize)}
+}
+
+// NewXTSReadWriterAt is NewXTSReaderAt that can also write. A write that
+// covers only part of a sector reads, decrypts and re-encrypts the rest of
+// it. Whole sectors skipped by a write past the end are not written and
+// read back as garbage, and the volume can't end in a piece of a sector
+// shorter than one block.
+func NewXTSReadWriterAt(rw ReadWriterAt, x *MyXTS, sectorSize int) ReadWriterAt {
+	if sectorSize < xtsBlockSize {
+		return nil
+	}
+
+	return &xtsVolume{r: rw, w: rw, x: x, sectorSize: int64(sectorSize)}
+}
+
+// readSector reads and decrypts sector n into buf and returns its length,
+// 0 past the end of the volume.
+func (v *xtsVolume) readSector(buf []byte, n int64) (int, error) {
+	k, err := v.r.ReadAt(buf, n*v.sectorSize)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if k == 0 {
+		return 0, nil
+	}
+	if err := v.x.Decrypt(buf[:k], buf[:k], uint64(n)); err != nil {
+		return 0, err
+	}
+
+	return k, nil
+}
+
+func (v *xtsVolume) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("modes: negative offset")
+	}
+
+	buf := make([]byte, v.sectorSize)
+	read := 0
+	for read < len(p) {
+		pos := off + int64(read)
+		sector, in := pos/v.sectorSize, pos%v.sectorSize
+		k, err := v.readSector(buf, sector)
+		if err != nil {
+			return read, err
+		}
+		if int64(k) <= in {
+			return read, io.EOF
+		}
+
+		c := copy(p[read:], buf[in:k])
+		read += c
+		if int64(k) < v.sectorSize && read < len(p) {
+			return read, io.EOF
+		}
+	}
+
+	return read, nil
+}
+
+func (v *xtsVolume) WriteAt(p []byte, off int64) (int, error) {
+	if v.w == nil {
+		return 0, errors.New("modes: XTS volume is read only")
+	}
+	if off < 0 {
+		return 0, errors.New("modes: negative offset")
+	}
+
+	buf := make([]byte, v.sectorSize)
+	written := 0
+	for written < len(p) {
+		pos := off + int64(written)
+		sector, in := pos/v.sectorSize, pos%v.sectorSize
+		c := int(v.sectorSize - in)
+		if c > len(p)-written {
+			c = len(p) - written
+		}
+
+		// the sector is as long as before or as far as the write goes
+		k := 0
+		if in != 0 || int64(c) < v.sectorSize {
+			var err error
+			if k, err = v.readSector(buf, sector); err != nil {
+				return written, err
+			}
+		}
+		copy(buf[in:], p[written:written+c])
+		if end := int(in) + c; end > k {
+			if k < int(in) {
+				// a write past the end leaves a hole of zeros
+				for i := k; i < int(in); i++ {
+					buf[i] = 0
+				}
+			}
+			k = end
+		}
+
+		if err := v.x.Encrypt(buf[:k], buf[:k], uint64(sector)); err != nil {
+			return written, err
+		}
+		if _, err := v.w.WriteAt(buf[:k], sector*v.sectorSize); err != nil {
+			return written, err
+		}
+		written += c
+	}
+
+	return written, nil
+}
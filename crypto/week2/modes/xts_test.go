@@ -0,0 +1,207 @@
+package modes_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// xtsVectors are XTS-AES-128 vectors of IEEE 1619 annex B. The plaintext
+// of vector 4 is the bytes 0 to 255 twice and that of vector 5 the
+// ciphertext of vector 4.
+var xtsVectors = []struct {
+	name       string
+	key        string
+	sector     uint64
+	plaintext  string
+	ciphertext string
+}{
+	{"vector 1", "00000000000000000000000000000000 00000000000000000000000000000000", 0,
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"917cf69ebd68b2ec9b9fe9a3eadda692cd43d2f59598ed858c02c2652fbf922e"},
+	{"vector 2", "11111111111111111111111111111111 22222222222222222222222222222222", 0x3333333333,
+		"4444444444444444444444444444444444444444444444444444444444444444",
+		"c454185e6a16936e39334038acef838bfb186fff7480adc4289382ecd6d394f0"},
+	{"vector 3", "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 22222222222222222222222222222222", 0x3333333333,
+		"4444444444444444444444444444444444444444444444444444444444444444",
+		"af85336b597afc1a900b2eb21ec949d292df4c047e0b21532186a5971a227a89"},
+	{"vector 4", "27182818284590452353602874713526 31415926535897932384626433832795", 0, "", xtsVector4},
+	{"vector 5", "27182818284590452353602874713526 31415926535897932384626433832795", 1, xtsVector4, xtsVector5},
+	{"vector 15", "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 bfbebdbcbbbab9b8b7b6b5b4b3b2b1b0", 0x123456789a,
+		"000102030405060708090a0b0c0d0e0f10",
+		"6c1625db4671522d3d7599601de7ca09ed"},
+	{"vector 16", "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 bfbebdbcbbbab9b8b7b6b5b4b3b2b1b0", 0x123456789a,
+		"000102030405060708090a0b0c0d0e0f1011",
+		"d069444b7a7e0cab09e24447d24deb1fedbf"},
+	{"vector 17", "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 bfbebdbcbbbab9b8b7b6b5b4b3b2b1b0", 0x123456789a,
+		"000102030405060708090a0b0c0d0e0f101112",
+		"e5df1351c0544ba1350b3363cd8ef4beedbf9d"},
+	{"vector 18", "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0 bfbebdbcbbbab9b8b7b6b5b4b3b2b1b0", 0x123456789a,
+		"000102030405060708090a0b0c0d0e0f10111213",
+		"9d84c813f719aa2c7be3f66171c7c5c2edbf9dac"},
+}
+
+const (
+	xtsVector4 = "" +
+		"27a7479befa1d476489f308cd4cfa6e2a96e4bbe3208ff25287dd3819616e89c" +
+		"c78cf7f5e543445f8333d8fa7f56000005279fa5d8b5e4ad40e736ddb4d35412" +
+		"328063fd2aab53e5ea1e0a9f332500a5df9487d07a5c92cc512c8866c7e860ce" +
+		"93fdf166a24912b422976146ae20ce846bb7dc9ba94a767aaef20c0d61ad0265" +
+		"5ea92dc4c4e41a8952c651d33174be51a10c421110e6d81588ede82103a252d8" +
+		"a750e8768defffed9122810aaeb99f9172af82b604dc4b8e51bcb08235a6f434" +
+		"1332e4ca60482a4ba1a03b3e65008fc5da76b70bf1690db4eae29c5f1badd03c" +
+		"5ccf2a55d705ddcd86d449511ceb7ec30bf12b1fa35b913f9f747a8afd1b130e" +
+		"94bff94effd01a91735ca1726acd0b197c4e5b03393697e126826fb6bbde8ecc" +
+		"1e08298516e2c9ed03ff3c1b7860f6de76d4cecd94c8119855ef5297ca67e9f3" +
+		"e7ff72b1e99785ca0a7e7720c5b36dc6d72cac9574c8cbbc2f801e23e56fd344" +
+		"b07f22154beba0f08ce8891e643ed995c94d9a69c9f1b5f499027a78572aeebd" +
+		"74d20cc39881c213ee770b1010e4bea718846977ae119f7a023ab58cca0ad752" +
+		"afe656bb3c17256a9f6e9bf19fdd5a38fc82bbe872c5539edb609ef4f79c203e" +
+		"bb140f2e583cb2ad15b4aa5b655016a8449277dbd477ef2c8d6c017db738b18d" +
+		"eb4a427d1923ce3ff262735779a418f20a282df920147beabe421ee5319d0568"
+	xtsVector5 = "" +
+		"264d3ca8512194fec312c8c9891f279fefdd608d0c027b60483a3fa811d65ee5" +
+		"9d52d9e40ec5672d81532b38b6b089ce951f0f9c35590b8b978d175213f329bb" +
+		"1c2fd30f2f7f30492a61a532a79f51d36f5e31a7c9a12c286082ff7d2394d18f" +
+		"783e1a8e72c722caaaa52d8f065657d2631fd25bfd8e5baad6e527d763517501" +
+		"c68c5edc3cdd55435c532d7125c8614deed9adaa3acade5888b87bef641c4c99" +
+		"4c8091b5bcd387f3963fb5bc37aa922fbfe3df4e5b915e6eb514717bdd2a7407" +
+		"9a5073f5c4bfd46adf7d282e7a393a52579d11a028da4d9cd9c77124f9648ee3" +
+		"83b1ac763930e7162a8d37f350b2f74b8472cf09902063c6b32e8c2d9290cefb" +
+		"d7346d1c779a0df50edcde4531da07b099c638e83a755944df2aef1aa31752fd" +
+		"323dcb710fb4bfbb9d22b925bc3577e1b8949e729a90bbafeacf7f7879e7b114" +
+		"7e28ba0bae940db795a61b15ecf4df8db07b824bb062802cc98a9545bb2aaeed" +
+		"77cb3fc6db15dcd7d80d7d5bc406c4970a3478ada8899b329198eb61c193fb62" +
+		"75aa8ca340344a75a862aebe92eee1ce032fd950b47d7704a3876923b4ad6284" +
+		"4bf4a09c4dbe8b4397184b7471360c9564880aedddb9baa4af2e75394b08cd32" +
+		"ff479c57a07d3eab5d54de5f9738b8d27f27a9f0ab11799d7b7ffefb2704c95c" +
+		"6ad12c39f1e867a4b7b1d7818a4b753dfd2a89ccb45e001a03a867b187f225dd"
+)
+
+func TestXTSVectors(t *testing.T) {
+	for _, v := range xtsVectors {
+		x, err := modes.NewXTSAES(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pt := testutil.Unhex(v.plaintext)
+		if v.plaintext == "" {
+			for k := 0; k < 512; k++ {
+				pt = append(pt, byte(k))
+			}
+		}
+		want := testutil.Unhex(v.ciphertext)
+
+		got := make([]byte, len(pt))
+		if err := x.Encrypt(got, pt, v.sector); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: encrypt got %x, want %x", v.name, got, want)
+		}
+		if err := x.Decrypt(got, got, v.sector); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, pt) {
+			t.Fatalf("%s: decrypt got %x, want %x", v.name, got, pt)
+		}
+	}
+}
+
+// memVolume is a growable in-memory file.
+type memVolume struct {
+	data []byte
+}
+
+func (m *memVolume) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memVolume) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// TestXTSVolume writes an image through NewXTSReadWriterAt in random
+// pieces and compares it with the sectors encrypted one by one, then reads
+// it back at random offsets.
+func TestXTSVolume(t *testing.T) {
+	const sectorSize = 512
+	rnd := rand.New(rand.NewSource(1619))
+	key := make([]byte, 64)
+	rnd.Read(key)
+	x, err := modes.NewXTSAES(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last sector is short and needs ciphertext stealing
+	image := make([]byte, 37*sectorSize+100)
+	rnd.Read(image)
+	want := make([]byte, len(image))
+	for off := 0; off < len(image); off += sectorSize {
+		end := off + sectorSize
+		if end > len(image) {
+			end = len(image)
+		}
+		if err := x.Encrypt(want[off:end], image[off:end], uint64(off/sectorSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &memVolume{}
+	vol := modes.NewXTSReadWriterAt(m, x, sectorSize)
+	for off := 0; off < len(image); {
+		// a write may not leave the volume ending in less than a block
+		n := 1 + rnd.Intn(3*sectorSize)
+		if r := (off + n) % sectorSize; r > 0 && r < 16 {
+			n += 16
+		}
+		if off+n > len(image) || len(image)-off-n < 16 {
+			n = len(image) - off
+		}
+		if _, err := vol.WriteAt(image[off:off+n], int64(off)); err != nil {
+			t.Fatalf("WriteAt %d+%d failed with: %v", off, n, err)
+		}
+		off += n
+	}
+	if !bytes.Equal(m.data, want) {
+		t.Fatalf("volume written in pieces differs from the encrypted sectors")
+	}
+
+	// overwrite a piece in the middle and read everything back
+	patch := []byte("patched across a sector boundary")
+	copy(image[3*sectorSize-10:], patch)
+	if _, err := vol.WriteAt(patch, 3*sectorSize-10); err != nil {
+		t.Fatal(err)
+	}
+	for k := 0; k < 200; k++ {
+		off := rnd.Intn(len(image))
+		p := make([]byte, rnd.Intn(2*sectorSize))
+		n, err := vol.ReadAt(p, int64(off))
+		if off+len(p) <= len(image) && err != nil {
+			t.Fatalf("ReadAt %d+%d failed with: %v", off, len(p), err)
+		}
+		if off+len(p) > len(image) && err != io.EOF {
+			t.Fatalf("ReadAt %d+%d past the end returned %v", off, len(p), err)
+		}
+		if !bytes.Equal(p[:n], image[off:off+n]) {
+			t.Fatalf("ReadAt %d+%d got %s", off, len(p), hex.EncodeToString(p[:n]))
+		}
+	}
+}
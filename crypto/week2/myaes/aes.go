@@ -0,0 +1,306 @@
+// Package myaes is a pure Go AES (FIPS-197) that can be used as the
+// cipher.Block of the week2 modes. Unlike crypto/aes it does not hide how
+// it works: the key schedule, the round keys and the state after every
+// round are all available, which is what attacks on AES are built from.
+//
+// NewCipher returns the usual table-based implementation; NewBitsliced
+// returns one that works on bit planes and never indexes memory with
+// secret data.
+package myaes
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// BlockSize is the AES block size in bytes.
+const BlockSize = 16
+
+// ErrRounds is returned by NewCipherRounds for a number of rounds AES
+// doesn't have.
+var ErrRounds = errors.New("myaes: invalid number of rounds")
+
+// KeySizeError is returned for a key that is not 16, 24 or 32 bytes long.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "myaes: invalid key size " + strconv.Itoa(int(k))
+}
+
+// Cipher is the table-based AES.
+type Cipher struct {
+	nr int
+	// enc is the expanded key, dec the one for the equivalent inverse
+	// cipher.
+	enc []uint32
+	dec []uint32
+}
+
+var _ cipher.Block = (*Cipher)(nil)
+
+// NewCipher returns AES-128, AES-192 or AES-256 for a 16, 24 or 32 byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	enc, err := KeyExpansion(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCipher(enc, len(enc)/4-1), nil
+}
+
+// NewCipherRounds returns AES cut down to the given number of rounds, from
+// 1 up to the full 10, 12 or 14. The last round skips MixColumns as the
+// last round of AES does, which is how reduced-round AES is usually
+// attacked.
+func NewCipherRounds(key []byte, rounds int) (*Cipher, error) {
+	enc, err := KeyExpansion(key)
+	if err != nil {
+		return nil, err
+	}
+	if rounds < 1 || rounds > len(enc)/4-1 {
+		return nil, ErrRounds
+	}
+
+	return newCipher(enc, rounds), nil
+}
+
+func newCipher(enc []uint32, nr int) *Cipher {
+	c := &Cipher{
+		nr:  nr,
+		enc: enc[:4*(nr+1)],
+		dec: make([]uint32, 4*(nr+1)),
+	}
+
+	// the decryption round keys are the encryption ones in reverse, with
+	// InvMixColumns applied to all but the first and last
+	for r := 0; r <= nr; r++ {
+		for k := 0; k < 4; k++ {
+			w := c.enc[4*(nr-r)+k]
+			if r > 0 && r < nr {
+				w = invMixColumn(w)
+			}
+			c.dec[4*r+k] = w
+		}
+	}
+
+	return c
+}
+
+// KeyExpansion returns the FIPS-197 key schedule of key as 4*(Nr+1) words.
+func KeyExpansion(key []byte) ([]uint32, error) {
+	nk := len(key) / 4
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, KeySizeError(len(key))
+	}
+
+	nr := nk + 6
+	w := make([]uint32, 4*(nr+1))
+	for i := 0; i < nk; i++ {
+		w[i] = binary.BigEndian.Uint32(key[4*i:])
+	}
+
+	rcon := uint32(1)
+	for i := nk; i < len(w); i++ {
+		t := w[i-1]
+		if i%nk == 0 {
+			t = subWord(t<<8|t>>24) ^ rcon<<24
+			rcon = uint32(xtime(byte(rcon)))
+		} else if nk > 6 && i%nk == 4 {
+			t = subWord(t)
+		}
+		w[i] = w[i-nk] ^ t
+	}
+
+	return w, nil
+}
+
+// InvertKeySchedule runs the AES-128 key schedule backwards from the round
+// key of the given round, 0 to 10, and returns the cipher key. Every round
+// key of AES-128 determines the whole schedule, so recovering any one of
+// them breaks the cipher.
+func InvertKeySchedule(roundKey []byte, round int) ([]byte, error) {
+	if len(roundKey) != BlockSize {
+		return nil, KeySizeError(len(roundKey))
+	}
+	if round < 0 || round > 10 {
+		return nil, ErrRounds
+	}
+
+	var w [4]uint32
+	for k := range w {
+		w[k] = binary.BigEndian.Uint32(roundKey[4*k:])
+	}
+
+	for r := round; r > 0; r-- {
+		// w[i] = w[i-4] ^ w[i-1] for the last three words of the round
+		// key and w[i] = w[i-4] ^ SubWord(RotWord(w[i-1])) ^ Rcon for the
+		// first
+		for k := 3; k > 0; k-- {
+			w[k] ^= w[k-1]
+		}
+		w[0] ^= subWord(w[3]<<8|w[3]>>24) ^ uint32(rcon(r))<<24
+	}
+
+	key := make([]byte, BlockSize)
+	for k := range w {
+		binary.BigEndian.PutUint32(key[4*k:], w[k])
+	}
+
+	return key, nil
+}
+
+// rcon returns the round constant x^(r-1) used for round key r.
+func rcon(r int) byte {
+	c := byte(1)
+	for k := 1; k < r; k++ {
+		c = xtime(c)
+	}
+
+	return c
+}
+
+// BlockSize returns the AES block size.
+func (c *Cipher) BlockSize() int {
+	return BlockSize
+}
+
+// Rounds returns the number of rounds, 10, 12 or 14.
+func (c *Cipher) Rounds() int {
+	return c.nr
+}
+
+// RoundKeys returns the Nr+1 round keys, the first being the one added
+// before round 1.
+func (c *Cipher) RoundKeys() [][BlockSize]byte {
+	keys := make([][BlockSize]byte, c.nr+1)
+	for r := range keys {
+		for k := 0; k < 4; k++ {
+			binary.BigEndian.PutUint32(keys[r][4*k:], c.enc[4*r+k])
+		}
+	}
+
+	return keys
+}
+
+// Encrypt encrypts the first block of src into dst. Dst and src may point
+// to the same memory.
+func (c *Cipher) Encrypt(dst, src []byte) {
+	if len(src) < BlockSize {
+		panic("myaes: input not full block")
+	}
+	if len(dst) < BlockSize {
+		panic("myaes: output not full block")
+	}
+
+	c.encrypt(dst, src, nil)
+}
+
+// EncryptTrace encrypts src like Encrypt and also returns the state after
+// each round: element 0 is the input after the first AddRoundKey, element
+// r the state at the end of round r, the last one being the ciphertext.
+func (c *Cipher) EncryptTrace(dst, src []byte) [][BlockSize]byte {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("myaes: not full block")
+	}
+
+	trace := make([][BlockSize]byte, 0, c.nr+1)
+	c.encrypt(dst, src, func(s0, s1, s2, s3 uint32) {
+		var state [BlockSize]byte
+		putState(state[:], s0, s1, s2, s3)
+		trace = append(trace, state)
+	})
+
+	return trace
+}
+
+func (c *Cipher) encrypt(dst, src []byte, trace func(s0, s1, s2, s3 uint32)) {
+	xk := c.enc
+	s0 := binary.BigEndian.Uint32(src[0:4]) ^ xk[0]
+	s1 := binary.BigEndian.Uint32(src[4:8]) ^ xk[1]
+	s2 := binary.BigEndian.Uint32(src[8:12]) ^ xk[2]
+	s3 := binary.BigEndian.Uint32(src[12:16]) ^ xk[3]
+	if trace != nil {
+		trace(s0, s1, s2, s3)
+	}
+
+	for r := 1; r < c.nr; r++ {
+		k := xk[4*r : 4*r+4]
+		t0 := te[0][s0>>24] ^ te[1][s1>>16&0xff] ^ te[2][s2>>8&0xff] ^ te[3][s3&0xff] ^ k[0]
+		t1 := te[0][s1>>24] ^ te[1][s2>>16&0xff] ^ te[2][s3>>8&0xff] ^ te[3][s0&0xff] ^ k[1]
+		t2 := te[0][s2>>24] ^ te[1][s3>>16&0xff] ^ te[2][s0>>8&0xff] ^ te[3][s1&0xff] ^ k[2]
+		t3 := te[0][s3>>24] ^ te[1][s0>>16&0xff] ^ te[2][s1>>8&0xff] ^ te[3][s2&0xff] ^ k[3]
+		s0, s1, s2, s3 = t0, t1, t2, t3
+		if trace != nil {
+			trace(s0, s1, s2, s3)
+		}
+	}
+
+	// the last round has no MixColumns
+	k := xk[4*c.nr : 4*c.nr+4]
+	t0 := lastRound(sbox[:], s0, s1, s2, s3) ^ k[0]
+	t1 := lastRound(sbox[:], s1, s2, s3, s0) ^ k[1]
+	t2 := lastRound(sbox[:], s2, s3, s0, s1) ^ k[2]
+	t3 := lastRound(sbox[:], s3, s0, s1, s2) ^ k[3]
+	if trace != nil && c.nr > 0 {
+		trace(t0, t1, t2, t3)
+	}
+
+	putState(dst, t0, t1, t2, t3)
+}
+
+// Decrypt decrypts the first block of src into dst. Dst and src may point
+// to the same memory.
+func (c *Cipher) Decrypt(dst, src []byte) {
+	if len(src) < BlockSize {
+		panic("myaes: input not full block")
+	}
+	if len(dst) < BlockSize {
+		panic("myaes: output not full block")
+	}
+
+	xk := c.dec
+	s0 := binary.BigEndian.Uint32(src[0:4]) ^ xk[0]
+	s1 := binary.BigEndian.Uint32(src[4:8]) ^ xk[1]
+	s2 := binary.BigEndian.Uint32(src[8:12]) ^ xk[2]
+	s3 := binary.BigEndian.Uint32(src[12:16]) ^ xk[3]
+
+	for r := 1; r < c.nr; r++ {
+		k := xk[4*r : 4*r+4]
+		t0 := td[0][s0>>24] ^ td[1][s3>>16&0xff] ^ td[2][s2>>8&0xff] ^ td[3][s1&0xff] ^ k[0]
+		t1 := td[0][s1>>24] ^ td[1][s0>>16&0xff] ^ td[2][s3>>8&0xff] ^ td[3][s2&0xff] ^ k[1]
+		t2 := td[0][s2>>24] ^ td[1][s1>>16&0xff] ^ td[2][s0>>8&0xff] ^ td[3][s3&0xff] ^ k[2]
+		t3 := td[0][s3>>24] ^ td[1][s2>>16&0xff] ^ td[2][s1>>8&0xff] ^ td[3][s0&0xff] ^ k[3]
+		s0, s1, s2, s3 = t0, t1, t2, t3
+	}
+
+	k := xk[4*c.nr : 4*c.nr+4]
+	t0 := lastRound(invSbox[:], s0, s3, s2, s1) ^ k[0]
+	t1 := lastRound(invSbox[:], s1, s0, s3, s2) ^ k[1]
+	t2 := lastRound(invSbox[:], s2, s1, s0, s3) ^ k[2]
+	t3 := lastRound(invSbox[:], s3, s2, s1, s0) ^ k[3]
+
+	putState(dst, t0, t1, t2, t3)
+}
+
+// lastRound returns one column of SubBytes and ShiftRows, taking row i
+// from the i-th word.
+func lastRound(box []byte, a, b, c, d uint32) uint32 {
+	return uint32(box[a>>24])<<24 | uint32(box[b>>16&0xff])<<16 | uint32(box[c>>8&0xff])<<8 | uint32(box[d&0xff])
+}
+
+func putState(dst []byte, s0, s1, s2, s3 uint32) {
+	binary.BigEndian.PutUint32(dst[0:4], s0)
+	binary.BigEndian.PutUint32(dst[4:8], s1)
+	binary.BigEndian.PutUint32(dst[8:12], s2)
+	binary.BigEndian.PutUint32(dst[12:16], s3)
+}
+
+func subWord(w uint32) uint32 {
+	return uint32(sbox[w>>24])<<24 | uint32(sbox[w>>16&0xff])<<16 | uint32(sbox[w>>8&0xff])<<8 | uint32(sbox[w&0xff])
+}
+
+func invMixColumn(w uint32) uint32 {
+	return td[0][sbox[w>>24]] ^ td[1][sbox[w>>16&0xff]] ^ td[2][sbox[w>>8&0xff]] ^ td[3][sbox[w&0xff]]
+}
@@ -0,0 +1,232 @@
+package myaes_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+	"github.com/lumieru/coursera/crypto/week2/myaes"
+)
+
+// aesVectors are the examples of FIPS-197 appendix C.
+var aesVectors = []struct {
+	key        string
+	ciphertext string
+}{
+	{"000102030405060708090a0b0c0d0e0f", "69c4e0d86a7b0430d8cdb78070b4c55a"},
+	{"000102030405060708090a0b0c0d0e0f1011121314151617", "dda97ca4864cdfe06eaf70a0ec0d7191"},
+	{"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "8ea2b7ca516745bfeafc49904b496089"},
+}
+
+const aesVectorPlaintext = "00112233445566778899aabbccddeeff"
+
+// keyScheduleVectors are the key expansion examples of FIPS-197 appendix
+// A, checked by their last round key.
+var keyScheduleVectors = []struct {
+	key     string
+	lastKey string
+}{
+	{"2b7e151628aed2a6abf7158809cf4f3c", "d014f9a8c9ee2589e13f0cc8b6630ca6"},
+	{"8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", "e98ba06f448c773c8ecc720401002202"},
+	{"603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", "fe4890d1e6188d0b046df344706c631e"},
+}
+
+// aesTrace is the round by round example of FIPS-197 appendix B: the
+// state at the start of some rounds, index 0 being the input.
+var aesTrace = struct {
+	key    string
+	states map[int]string
+}{
+	"2b7e151628aed2a6abf7158809cf4f3c",
+	map[int]string{
+		0:  "3243f6a8885a308d313198a2e0370734",
+		1:  "193de3bea0f4e22b9ac68d2ae9f84808",
+		2:  "a49c7ff2689f352b6b5bea43026a5049",
+		10: "eb40f21e592e38848ba113e71bc342d2",
+		11: "3925841d02dc09fbdc118597196a0b32",
+	},
+}
+
+type newBlock func(key []byte) (cipher.Block, error)
+
+var aesImpls = []struct {
+	name string
+	new  newBlock
+}{
+	{"table", func(key []byte) (cipher.Block, error) { return myaes.NewCipher(key) }},
+	{"bitsliced", func(key []byte) (cipher.Block, error) { return myaes.NewBitsliced(key) }},
+}
+
+func TestAESVectors(t *testing.T) {
+	pt := testutil.Unhex(aesVectorPlaintext)
+	for _, impl := range aesImpls {
+		for _, v := range aesVectors {
+			block, err := impl.new(testutil.Unhex(v.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]byte, aes.BlockSize)
+			block.Encrypt(got, pt)
+			if want := testutil.Unhex(v.ciphertext); !bytes.Equal(got, want) {
+				t.Fatalf("%s key %s: encrypt got %x, want %x", impl.name, v.key, got, want)
+			}
+			block.Decrypt(got, got)
+			if !bytes.Equal(got, pt) {
+				t.Fatalf("%s key %s: decrypt got %x, want %x", impl.name, v.key, got, pt)
+			}
+		}
+	}
+}
+
+func TestAESKeySchedule(t *testing.T) {
+	for _, v := range keyScheduleVectors {
+		c, err := myaes.NewCipher(testutil.Unhex(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := c.RoundKeys()
+		if !bytes.Equal(keys[0][:], testutil.Unhex(v.key)[:16]) {
+			t.Fatalf("key %s: first round key %x", v.key, keys[0])
+		}
+		if got, want := keys[len(keys)-1][:], testutil.Unhex(v.lastKey); !bytes.Equal(got, want) {
+			t.Fatalf("key %s: last round key %x, want %x", v.key, got, want)
+		}
+	}
+
+	if _, err := myaes.NewCipher(make([]byte, 20)); err == nil {
+		t.Fatalf("20 byte key accepted")
+	}
+}
+
+// TestAESReduced checks that AES cut to any number of rounds decrypts what
+// it encrypts, that all 10 rounds are plain AES-128 and that every round
+// key leads back to the cipher key.
+func TestAESReduced(t *testing.T) {
+	key := testutil.Unhex(aesTrace.key)
+	full, err := myaes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := full.RoundKeys()
+
+	pt := testutil.Unhex(aesTrace.states[0])
+	for r := 1; r <= full.Rounds(); r++ {
+		c, err := myaes.NewCipherRounds(key, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ct := make([]byte, aes.BlockSize)
+		c.Encrypt(ct, pt)
+		got := make([]byte, aes.BlockSize)
+		c.Decrypt(got, ct)
+		if !bytes.Equal(got, pt) {
+			t.Fatalf("%d rounds: decrypt got %x, want %x", r, got, pt)
+		}
+
+		master, err := myaes.InvertKeySchedule(keys[r][:], r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(master, key) {
+			t.Fatalf("round %d key inverts to %x, want %x", r, master, key)
+		}
+	}
+
+	c, err := myaes.NewCipherRounds(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := make([]byte, aes.BlockSize)
+	c.Encrypt(ct, pt)
+	if want := testutil.Unhex(aesTrace.states[11]); !bytes.Equal(ct, want) {
+		t.Fatalf("10 rounds: got %x, want %x", ct, want)
+	}
+	for _, r := range []int{0, 11} {
+		if _, err := myaes.NewCipherRounds(key, r); err != myaes.ErrRounds {
+			t.Fatalf("%d rounds: got error %v", r, err)
+		}
+	}
+}
+
+func TestAESTrace(t *testing.T) {
+	c, err := myaes.NewCipher(testutil.Unhex(aesTrace.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the trace holds the state after each round, which is the state at
+	// the start of the next one
+	dst := make([]byte, aes.BlockSize)
+	trace := c.EncryptTrace(dst, testutil.Unhex(aesTrace.states[0]))
+	if len(trace) != c.Rounds()+1 {
+		t.Fatalf("trace has %d states, want %d", len(trace), c.Rounds()+1)
+	}
+	for r, state := range aesTrace.states {
+		if r == 0 {
+			continue
+		}
+		if got, want := trace[r-1][:], testutil.Unhex(state); !bytes.Equal(got, want) {
+			t.Fatalf("start of round %d: got %x, want %x", r, got, want)
+		}
+	}
+	if !bytes.Equal(dst, trace[len(trace)-1][:]) {
+		t.Fatalf("output %x is not the last state %x", dst, trace[len(trace)-1])
+	}
+}
+
+// TestAESCross compares both implementations with crypto/aes on random
+// keys and blocks, and runs them under the CBC and CTR modes.
+func TestAESCross(t *testing.T) {
+	for k := 0; k < 300; k++ {
+		key := make([]byte, 16+8*(k%3))
+		msg := make([]byte, 5*aes.BlockSize+k%aes.BlockSize)
+		iv := make([]byte, aes.BlockSize)
+		for _, b := range [][]byte{key, msg, iv} {
+			if _, err := rand.Read(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		std, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]byte, len(msg))
+		cipher.NewCTR(std, iv).XORKeyStream(want, msg)
+		stdEnc := modes.NewMyCBCEncrypter(std, iv)
+		wantCBC := stdEnc.Encrypt(make([]byte, stdEnc.EncryptedSize(len(msg))), msg)
+
+		for _, impl := range aesImpls {
+			block, err := impl.new(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]byte, len(msg))
+			modes.NewMyCTR(block, iv).XORKeyStream(got, msg)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s CTR with %d byte key differs from crypto/aes", impl.name, len(key))
+			}
+
+			enc := modes.NewMyCBCEncrypter(block, iv)
+			got = enc.Encrypt(make([]byte, enc.EncryptedSize(len(msg))), msg)
+			if !bytes.Equal(got, wantCBC) {
+				t.Fatalf("%s CBC with %d byte key differs from crypto/aes", impl.name, len(key))
+			}
+			plain, err := modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(got)), got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, msg) {
+				t.Fatalf("%s CBC with %d byte key doesn't round trip", impl.name, len(key))
+			}
+		}
+	}
+}
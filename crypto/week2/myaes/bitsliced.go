@@ -0,0 +1,249 @@
+package myaes
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// planes is the AES state sliced into bits: bit p of plane i is bit i of
+// state byte p, where byte p sits in row p%4 and column p/4. Every step of
+// the cipher is then a few logical operations on all 16 bytes at once and
+// nothing is looked up in a table, so the timing doesn't depend on the key
+// or the data.
+type planes [8]uint16
+
+// Bitsliced is the bitsliced AES.
+type Bitsliced struct {
+	nr   int
+	keys []planes
+}
+
+var _ cipher.Block = (*Bitsliced)(nil)
+
+// NewBitsliced returns a bitsliced AES-128, AES-192 or AES-256 for a 16, 24
+// or 32 byte key.
+func NewBitsliced(key []byte) (*Bitsliced, error) {
+	w, err := KeyExpansion(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBitsliced(w, len(w)/4-1), nil
+}
+
+func newBitsliced(w []uint32, nr int) *Bitsliced {
+	b := &Bitsliced{
+		nr:   nr,
+		keys: make([]planes, nr+1),
+	}
+	var key [BlockSize]byte
+	for r := range b.keys {
+		for k := 0; k < 4; k++ {
+			binary.BigEndian.PutUint32(key[4*k:], w[4*r+k])
+		}
+		b.keys[r] = pack(key[:])
+	}
+
+	return b
+}
+
+// BlockSize returns the AES block size.
+func (b *Bitsliced) BlockSize() int {
+	return BlockSize
+}
+
+// Rounds returns the number of rounds.
+func (b *Bitsliced) Rounds() int {
+	return b.nr
+}
+
+// Encrypt encrypts the first block of src into dst. Dst and src may point
+// to the same memory.
+func (b *Bitsliced) Encrypt(dst, src []byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("myaes: not full block")
+	}
+
+	s := pack(src)
+	s.addRoundKey(&b.keys[0])
+	for r := 1; r <= b.nr; r++ {
+		s.subBytes()
+		s.shiftRows()
+		if r < b.nr {
+			s.mixColumns()
+		}
+		s.addRoundKey(&b.keys[r])
+	}
+
+	s.unpack(dst)
+}
+
+// Decrypt decrypts the first block of src into dst. Dst and src may point
+// to the same memory.
+func (b *Bitsliced) Decrypt(dst, src []byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("myaes: not full block")
+	}
+
+	s := pack(src)
+	for r := b.nr; r >= 1; r-- {
+		s.addRoundKey(&b.keys[r])
+		if r < b.nr {
+			s.invMixColumns()
+		}
+		s.invShiftRows()
+		s.invSubBytes()
+	}
+	s.addRoundKey(&b.keys[0])
+
+	s.unpack(dst)
+}
+
+func pack(block []byte) planes {
+	var s planes
+	for p := 0; p < BlockSize; p++ {
+		for i := uint(0); i < 8; i++ {
+			s[i] |= uint16(block[p]>>i&1) << uint(p)
+		}
+	}
+
+	return s
+}
+
+func (s *planes) unpack(block []byte) {
+	for p := 0; p < BlockSize; p++ {
+		var v byte
+		for i := uint(0); i < 8; i++ {
+			v |= byte(s[i]>>uint(p)&1) << i
+		}
+		block[p] = v
+	}
+}
+
+func (s *planes) addRoundKey(k *planes) {
+	for i := range s {
+		s[i] ^= k[i]
+	}
+}
+
+// subBytes computes the S-box as the inverse x^254 in GF(2^8) followed by
+// the affine transformation.
+func (s *planes) subBytes() {
+	inv := s.inverse()
+	for i := 0; i < 8; i++ {
+		s[i] = inv[i] ^ inv[(i+4)%8] ^ inv[(i+5)%8] ^ inv[(i+6)%8] ^ inv[(i+7)%8] ^ constant(0x63, i)
+	}
+}
+
+func (s *planes) invSubBytes() {
+	var a planes
+	for i := 0; i < 8; i++ {
+		a[i] = s[(i+2)%8] ^ s[(i+5)%8] ^ s[(i+7)%8] ^ constant(0x05, i)
+	}
+	*s = a.inverse()
+}
+
+// constant returns plane i of a state filled with byte c.
+func constant(c byte, i int) uint16 {
+	return -uint16(c >> uint(i) & 1)
+}
+
+// inverse returns x^254, which is x^-1 for x != 0 and 0 for x = 0.
+func (s *planes) inverse() planes {
+	r := *s
+	for k := 0; k < 6; k++ {
+		r = gfMul(&r, &r)
+		r = gfMul(&r, s)
+	}
+
+	return gfMul(&r, &r)
+}
+
+// gfMul multiplies every byte of a with the same byte of b in GF(2^8).
+func gfMul(a, b *planes) planes {
+	var t [15]uint16
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			t[i+j] ^= a[i] & b[j]
+		}
+	}
+
+	// x^8 = x^4 + x^3 + x + 1
+	for k := 14; k >= 8; k-- {
+		t[k-4] ^= t[k]
+		t[k-5] ^= t[k]
+		t[k-7] ^= t[k]
+		t[k-8] ^= t[k]
+	}
+
+	var p planes
+	copy(p[:], t[:8])
+	return p
+}
+
+// shiftRows rotates row r left by r columns. The bits of row r are 4
+// apart, so that is a rotation of the plane masked to the row.
+func (s *planes) shiftRows() {
+	for i := range s {
+		x := s[i]
+		for r := uint(1); r < 4; r++ {
+			m := uint16(0x1111) << r
+			row := x & m
+			x = x&^m | (row>>(4*r)|row<<(16-4*r))&m
+		}
+		s[i] = x
+	}
+}
+
+func (s *planes) invShiftRows() {
+	for i := range s {
+		x := s[i]
+		for r := uint(1); r < 4; r++ {
+			m := uint16(0x1111) << r
+			row := x & m
+			x = x&^m | (row<<(4*r)|row>>(16-4*r))&m
+		}
+		s[i] = x
+	}
+}
+
+// rotRows moves every byte of a column up by n rows.
+func rotRows(x uint16, n uint) uint16 {
+	m := uint16(0x1111) * (1<<(4-n) - 1)
+	return x>>n&m | x<<(4-n)&^m
+}
+
+// xtimes multiplies every byte by x.
+func (s *planes) xtimes() planes {
+	return planes{s[7], s[0] ^ s[7], s[1], s[2] ^ s[7], s[3] ^ s[7], s[4], s[5], s[6]}
+}
+
+// mixColumns computes 2*a[r] + 3*a[r+1] + a[r+2] + a[r+3] for every row.
+func (s *planes) mixColumns() {
+	var a1, c planes
+	for i := range s {
+		a1[i] = rotRows(s[i], 1)
+		c[i] = s[i] ^ a1[i]
+	}
+
+	c = c.xtimes()
+	for i := range s {
+		s[i] = c[i] ^ a1[i] ^ rotRows(s[i], 2) ^ rotRows(s[i], 3)
+	}
+}
+
+// invMixColumns first adds 4*(a[r] + a[r+2]) to every byte, which turns
+// MixColumns into InvMixColumns.
+func (s *planes) invMixColumns() {
+	var u planes
+	for i := range s {
+		u[i] = s[i] ^ rotRows(s[i], 2)
+	}
+
+	u = u.xtimes()
+	u = u.xtimes()
+	for i := range s {
+		s[i] ^= u[i]
+	}
+	s.mixColumns()
+}
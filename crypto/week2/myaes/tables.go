@@ -0,0 +1,81 @@
+package myaes
+
+// The S-boxes and round tables are computed from their definitions in
+// FIPS-197 section 5 instead of being pasted in.
+var (
+	sbox    [256]byte
+	invSbox [256]byte
+	// te[i][x] is column i of MixColumns applied to S(x) in row i, td the
+	// same for InvMixColumns and the inverse S-box.
+	te [4][256]uint32
+	td [4][256]uint32
+)
+
+func init() {
+	// exp and log tables over the generator 3
+	var exp, log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		x ^= xtime(x)
+	}
+
+	for i := 0; i < 256; i++ {
+		var inv byte
+		if i != 0 {
+			inv = exp[(255-int(log[i]))%255]
+		}
+
+		// affine transformation
+		s := inv ^ rotl8(inv, 1) ^ rotl8(inv, 2) ^ rotl8(inv, 3) ^ rotl8(inv, 4) ^ 0x63
+		sbox[i] = s
+		invSbox[s] = byte(i)
+	}
+
+	for i := 0; i < 256; i++ {
+		s := sbox[i]
+		w := uint32(mul(s, 2))<<24 | uint32(s)<<16 | uint32(s)<<8 | uint32(mul(s, 3))
+		is := invSbox[i]
+		v := uint32(mul(is, 14))<<24 | uint32(mul(is, 9))<<16 | uint32(mul(is, 13))<<8 | uint32(mul(is, 11))
+		for k := 0; k < 4; k++ {
+			te[k][i] = w
+			td[k][i] = v
+			w = w>>8 | w<<24
+			v = v>>8 | v<<24
+		}
+	}
+}
+
+// SBox returns the AES S-box applied to b.
+func SBox(b byte) byte {
+	return sbox[b]
+}
+
+// InvSBox returns the inverse AES S-box applied to b.
+func InvSBox(b byte) byte {
+	return invSbox[b]
+}
+
+// xtime multiplies b by x in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1.
+func xtime(b byte) byte {
+	return b<<1 ^ 0x1b&-(b>>7)
+}
+
+// mul multiplies a and b in GF(2^8).
+func mul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		a = xtime(a)
+		b >>= 1
+	}
+
+	return p
+}
+
+func rotl8(b byte, n uint) byte {
+	return b<<n | b>>(8-n)
+}
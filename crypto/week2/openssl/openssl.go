@@ -0,0 +1,193 @@
+// Package openssl reads and writes the files of `openssl enc` for AES in
+// CBC and CTR mode, on top of MyCBCEncrypter, MyCBCDecrypter and MyCTR.
+// Such a file is "Salted__", an 8-byte salt and the ciphertext; the key
+// and IV both come from the passphrase and the salt, with EVP_BytesToKey
+// by default or with PBKDF2 given -pbkdf2 or -iter.
+package openssl
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+const (
+	// Magic starts a salted file.
+	Magic = "Salted__"
+	// SaltSize is the salt size of openssl enc.
+	SaltSize = 8
+	// DefaultIterations is the PBKDF2 iteration count of -pbkdf2
+	// without -iter.
+	DefaultIterations = 10000
+)
+
+var ErrNotSalted = errors.New("openssl: missing Salted__ header")
+
+// KDF is how openssl enc turns the passphrase and salt into key and IV.
+type KDF struct {
+	// Hash is the -md digest, SHA-256 by default since OpenSSL 1.1.0 and
+	// MD5 before.
+	Hash func() hash.Hash
+	// Iterations is the PBKDF2 iteration count; 0 means EVP_BytesToKey
+	// with a single round, what openssl enc does without -pbkdf2.
+	Iterations int
+}
+
+// Digest returns the hash for an -md name.
+func Digest(name string) (func() hash.Hash, error) {
+	switch name {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+
+	return nil, fmt.Errorf("openssl: unsupported digest %s", name)
+}
+
+// BytesToKey is EVP_BytesToKey: D_1 = H^count(password || salt),
+// D_i = H^count(D_i-1 || password || salt), and the concatenation split
+// into key and IV.
+func BytesToKey(h func() hash.Hash, password, salt []byte, count, keyLen, ivLen int) (key, iv []byte) {
+	var out, d []byte
+	md := h()
+	for len(out) < keyLen+ivLen {
+		md.Reset()
+		md.Write(d)
+		md.Write(password)
+		md.Write(salt)
+		d = md.Sum(nil)
+		for k := 1; k < count; k++ {
+			md.Reset()
+			md.Write(d)
+			d = md.Sum(nil)
+		}
+		out = append(out, d...)
+	}
+
+	return out[:keyLen], out[keyLen : keyLen+ivLen]
+}
+
+func (k KDF) derive(password, salt []byte, keyLen int) (key, iv []byte) {
+	if k.Iterations == 0 {
+		return BytesToKey(k.Hash, password, salt, 1, keyLen, aes.BlockSize)
+	}
+
+	out := kdf.PBKDF2(password, salt, k.Iterations, keyLen+aes.BlockSize, k.Hash)
+	return out[:keyLen], out[keyLen:]
+}
+
+// cipherSpec is an openssl enc cipher: aes-128-cbc to aes-256-ctr.
+type cipherSpec struct {
+	keySize int
+	ctr     bool
+}
+
+func lookup(name string) (cipherSpec, error) {
+	var bits int
+	var mode string
+	if n, err := fmt.Sscanf(name, "aes-%d-%s", &bits, &mode); n != 2 || err != nil {
+		return cipherSpec{}, fmt.Errorf("openssl: unsupported cipher %s", name)
+	}
+	if (bits != 128 && bits != 192 && bits != 256) || (mode != "cbc" && mode != "ctr") {
+		return cipherSpec{}, fmt.Errorf("openssl: unsupported cipher %s", name)
+	}
+
+	return cipherSpec{keySize: bits / 8, ctr: mode == "ctr"}, nil
+}
+
+// xorCTR runs src through CTR with the whole IV as the counter, as openssl
+// enc does. The IV comes from the salt of a file that may be crafted, so
+// running out of counter space is ErrCounterOverflow rather than a panic.
+func xorCTR(block cipher.Block, iv, src []byte) ([]byte, error) {
+	ctr := modes.NewMyCTRWithCounter(block, iv, aes.BlockSize)
+	if err := ctr.CheckLength(len(src)); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(src))
+	ctr.XORKeyStream(out, src)
+	return out, nil
+}
+
+// Encrypt encrypts plaintext as `openssl enc -e -<cipherName>` with the
+// given KDF does, cipherName being aes-128-cbc, aes-192-ctr and so on. A
+// nil salt is replaced with a random one.
+func Encrypt(cipherName string, k KDF, password, salt, plaintext []byte) ([]byte, error) {
+	spec, err := lookup(cipherName)
+	if err != nil {
+		return nil, err
+	}
+	if salt == nil {
+		salt = make([]byte, SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	if len(salt) != SaltSize {
+		return nil, errors.New("openssl: salt must be 8 bytes")
+	}
+
+	key, iv := k.derive(password, salt, spec.keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(Magic), salt...)
+	if spec.ctr {
+		ct, err := xorCTR(block, iv, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, ct...), nil
+	}
+
+	enc := modes.NewMyCBCEncrypter(block, iv)
+	ct := enc.Encrypt(make([]byte, enc.EncryptedSize(len(plaintext))), plaintext)
+	// the IV isn't stored, it comes from the passphrase
+	return append(out, ct[aes.BlockSize:]...), nil
+}
+
+// Decrypt decrypts what `openssl enc -e -<cipherName>` wrote with the
+// given KDF. A wrong passphrase shows up as a padding error for CBC and
+// not at all for CTR, as openssl enc has no MAC.
+func Decrypt(cipherName string, k KDF, password, data []byte) ([]byte, error) {
+	spec, err := lookup(cipherName)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(Magic)+SaltSize || !bytes.Equal(data[:len(Magic)], []byte(Magic)) {
+		return nil, ErrNotSalted
+	}
+
+	salt := data[len(Magic) : len(Magic)+SaltSize]
+	ct := data[len(Magic)+SaltSize:]
+	key, iv := k.derive(password, salt, spec.keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.ctr {
+		return xorCTR(block, iv, ct)
+	}
+
+	src := append(iv, ct...)
+	return modes.NewMyCBCDecrypter(block, iv).Decrypt(make([]byte, len(src)), src)
+}
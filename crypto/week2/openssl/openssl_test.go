@@ -0,0 +1,124 @@
+package openssl_test
+
+import (
+	"bytes"
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+	"github.com/lumieru/coursera/crypto/week2/openssl"
+)
+
+const opensslPassword = "week2 interop"
+
+// opensslFixtures are made by testdata/gen.sh with OpenSSL 3.0.
+var opensslFixtures = []struct {
+	file       string
+	cipher     string
+	md         string
+	iterations int
+	plaintext  string
+}{
+	{"aes-128-cbc.md5.bin", "aes-128-cbc", "md5", 0, "plaintext.txt"},
+	{"aes-128-cbc.sha256.bin", "aes-128-cbc", "sha256", 0, "plaintext.txt"},
+	{"aes-256-ctr.md5.bin", "aes-256-ctr", "md5", 0, "plaintext.txt"},
+	{"aes-128-cbc.pbkdf2-sha256-10000.bin", "aes-128-cbc", "sha256", openssl.DefaultIterations, "plaintext.txt"},
+	{"aes-256-cbc.pbkdf2-sha512-1000.bin", "aes-256-cbc", "sha512", 1000, "plaintext.txt"},
+	{"aes-192-cbc.pbkdf2-sha1-500.bin", "aes-192-cbc", "sha1", 500, "plaintext.txt"},
+	{"aes-128-ctr.pbkdf2-sha256-1000.bin", "aes-128-ctr", "sha256", 1000, "plaintext.txt"},
+	{"empty.aes-128-cbc.pbkdf2-sha256-10000.bin", "aes-128-cbc", "sha256", openssl.DefaultIterations, ""},
+}
+
+// TestOpenSSLFixtures decrypts the files openssl enc wrote and checks
+// that encrypting the plaintext again with their salt gives the same
+// bytes, which is what openssl needs to read ours.
+func TestOpenSSLFixtures(t *testing.T) {
+	for _, f := range opensslFixtures {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", f.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []byte
+		if f.plaintext != "" {
+			if want, err = ioutil.ReadFile(filepath.Join("testdata", f.plaintext)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h, err := openssl.Digest(f.md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k := openssl.KDF{Hash: h, Iterations: f.iterations}
+
+		got, err := openssl.Decrypt(f.cipher, k, []byte(opensslPassword), data)
+		if err != nil {
+			t.Fatalf("%s: Decrypt failed with: %v", f.file, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %q, want %q", f.file, got, want)
+		}
+
+		salt := data[len(openssl.Magic) : len(openssl.Magic)+openssl.SaltSize]
+		again, err := openssl.Encrypt(f.cipher, k, []byte(opensslPassword), salt, want)
+		if err != nil {
+			t.Fatalf("%s: Encrypt failed with: %v", f.file, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Fatalf("%s: Encrypt got %x, want %x", f.file, again, data)
+		}
+
+		if _, err := openssl.Decrypt(f.cipher, k, []byte(opensslPassword), data[1:]); err != openssl.ErrNotSalted {
+			t.Fatalf("%s: Decrypt without the magic returned %v", f.file, err)
+		}
+	}
+}
+
+// `openssl enc -aes-256-cbc -md md5 -S 0001020304050607 -P` with the
+// fixture password; 48 bytes take three MD5 rounds.
+const (
+	bytesToKeyMD5Key = "5f242e02abab30dacea6301f52caae1bc4872e18527a261acba30ceb1442d236"
+	bytesToKeyMD5IV  = "2821e21921019e4b3f73516955a09502"
+)
+
+// TestBytesToKey checks EVP_BytesToKey against `openssl enc -P`, which
+// prints the salt, key and IV.
+func TestBytesToKey(t *testing.T) {
+	h, _ := openssl.Digest("md5")
+	key, iv := openssl.BytesToKey(h, []byte(opensslPassword), testutil.Unhex("0001020304050607"), 1, 32, 16)
+	wantKey, wantIV := testutil.Unhex(bytesToKeyMD5Key), testutil.Unhex(bytesToKeyMD5IV)
+	if !bytes.Equal(key, wantKey) || !bytes.Equal(iv, wantIV) {
+		t.Fatalf("got key %x iv %x, want %x and %x", key, iv, wantKey, wantIV)
+	}
+}
+
+// onesHash sums to all 0xff bytes whatever it is fed, so EVP_BytesToKey
+// with it gives the last counter block there is as the IV.
+type onesHash struct{}
+
+func (onesHash) Write(p []byte) (int, error) { return len(p), nil }
+func (onesHash) Sum(b []byte) []byte         { return append(b, bytes.Repeat([]byte{0xff}, 32)...) }
+func (onesHash) Reset()                      {}
+func (onesHash) Size() int                   { return 32 }
+func (onesHash) BlockSize() int              { return 64 }
+
+// TestCTRCounterOverflow checks that a CTR file whose IV leaves less
+// counter space than its body needs is an error, not a panic.
+func TestCTRCounterOverflow(t *testing.T) {
+	k := openssl.KDF{Hash: func() hash.Hash { return onesHash{} }}
+	salt := make([]byte, openssl.SaltSize)
+
+	if _, err := openssl.Encrypt("aes-128-ctr", k, nil, salt, make([]byte, 16)); err != nil {
+		t.Errorf("Encrypt of the last block failed with: %v", err)
+	}
+	if _, err := openssl.Encrypt("aes-128-ctr", k, nil, salt, make([]byte, 17)); err != modes.ErrCounterOverflow {
+		t.Errorf("Encrypt past the last block got %v", err)
+	}
+
+	data := append(append([]byte(openssl.Magic), salt...), make([]byte, 1000)...)
+	if _, err := openssl.Decrypt("aes-128-ctr", k, nil, data); err != modes.ErrCounterOverflow {
+		t.Errorf("Decrypt past the last block got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+#!/bin/sh
+# Regenerates the openssl enc fixtures of openssl_test.go. The salts are
+# random, so the files change, but the test only needs them to decrypt to
+# plaintext.txt and to come out the same when encrypted with their salt.
+set -e
+cd "$(dirname "$0")"
+OPENSSL=${OPENSSL:-openssl}
+pass="pass:week2 interop"
+
+"$OPENSSL" enc -e -aes-128-cbc -md md5 -pass "$pass" -in plaintext.txt -out aes-128-cbc.md5.bin
+"$OPENSSL" enc -e -aes-128-cbc -md sha256 -pass "$pass" -in plaintext.txt -out aes-128-cbc.sha256.bin
+"$OPENSSL" enc -e -aes-256-ctr -md md5 -pass "$pass" -in plaintext.txt -out aes-256-ctr.md5.bin
+"$OPENSSL" enc -e -aes-128-cbc -pbkdf2 -pass "$pass" -in plaintext.txt -out aes-128-cbc.pbkdf2-sha256-10000.bin
+"$OPENSSL" enc -e -aes-256-cbc -pbkdf2 -iter 1000 -md sha512 -pass "$pass" -in plaintext.txt -out aes-256-cbc.pbkdf2-sha512-1000.bin
+"$OPENSSL" enc -e -aes-192-cbc -pbkdf2 -iter 500 -md sha1 -pass "$pass" -in plaintext.txt -out aes-192-cbc.pbkdf2-sha1-500.bin
+"$OPENSSL" enc -e -aes-128-ctr -pbkdf2 -iter 1000 -pass "$pass" -in plaintext.txt -out aes-128-ctr.pbkdf2-sha256-1000.bin
+"$OPENSSL" enc -e -aes-128-cbc -pbkdf2 -pass "$pass" -in /dev/null -out empty.aes-128-cbc.pbkdf2-sha256-10000.bin
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+)
+
+// A passphrase gives an AES-256 or ChaCha20 key and a separate key for
+// the HMAC-SHA256 that ends the container, so CBC and CTR get checked as
+// well.
+const (
+	passphraseKeySize = 32
+	passphraseMACSize = sha256.Size
+)
+
+var (
+	passFileFlag = flag.String("pass-file", "", "Derive the keys from the passphrase on the first line of this file instead of using -key.")
+	passEnvFlag  = flag.String("pass-env", "", "Derive the keys from the passphrase in this environment variable instead of using -key.")
+	kdfFlag      = flag.String("kdf", "scrypt", "KDF for encrypting with a passphrase: pbkdf2 or scrypt. Decryption reads it from the header.")
+	kdfIterFlag  = flag.Int("kdf-iter", 600000, "PBKDF2-HMAC-SHA256 iterations for -kdf pbkdf2.")
+	scryptNFlag  = flag.Int("scrypt-n", 1<<15, "scrypt CPU and memory cost N, a power of two.")
+	scryptRFlag  = flag.Int("scrypt-r", 8, "scrypt block size r.")
+	scryptPFlag  = flag.Int("scrypt-p", 1, "scrypt parallelization p.")
+)
+
+func passphraseMode() bool {
+	return *passFileFlag != "" || *passEnvFlag != ""
+}
+
+func readPassphrase() ([]byte, error) {
+	if *passFileFlag != "" && *passEnvFlag != "" {
+		return nil, errors.New("need only one of -pass-file and -pass-env")
+	}
+	if *keyFlag != "" || *keyFileFlag != "" {
+		return nil, errors.New("a passphrase and a key can't be used together")
+	}
+
+	var passphrase []byte
+	if *passFileFlag != "" {
+		data, err := ioutil.ReadFile(*passFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		if k := bytes.IndexByte(data, '\n'); k >= 0 {
+			data = data[:k]
+		}
+		passphrase = bytes.TrimSuffix(data, []byte("\r"))
+	} else {
+		value, ok := os.LookupEnv(*passEnvFlag)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", *passEnvFlag)
+		}
+		passphrase = []byte(value)
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	return passphrase, nil
+}
+
+// newKDFParams returns the KDF of the flags with a fresh salt.
+func newKDFParams() (*kdf.Params, error) {
+	switch *kdfFlag {
+	case "pbkdf2":
+		return kdf.NewPBKDF2Params(*kdfIterFlag)
+	case "scrypt":
+		return kdf.NewScryptParams(*scryptNFlag, *scryptRFlag, *scryptPFlag)
+	}
+
+	return nil, fmt.Errorf("unknown -kdf %s", *kdfFlag)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	defer func(kdf string, iter, n int) {
+		*kdfFlag, *kdfIterFlag, *scryptNFlag = kdf, iter, n
+	}(*kdfFlag, *kdfIterFlag, *scryptNFlag)
+	*kdfIterFlag, *scryptNFlag = 1000, 1<<10
+
+	msg := []byte("Always avoid the two time pad!")
+	passphrase := []byte("correct horse")
+	for _, name := range []string{"pbkdf2", "scrypt"} {
+		*kdfFlag = name
+		params, err := newKDFParams()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var wire bytes.Buffer
+		if err := encryptContainer(TYPE_CTR, nil, passphrase, params, bytes.NewReader(msg), &wire); err != nil {
+			t.Fatalf("%s: encrypt failed with: %v", name, err)
+		}
+		var plain bytes.Buffer
+		if err := decryptContainer(nil, passphrase, bufio.NewReader(bytes.NewReader(wire.Bytes())), &plain); err != nil || !bytes.Equal(plain.Bytes(), msg) {
+			t.Errorf("%s: got %q, %v, want %q", name, plain.Bytes(), err, msg)
+		}
+
+		plain.Reset()
+		if err := decryptContainer(nil, []byte("correct horsf"), bufio.NewReader(bytes.NewReader(wire.Bytes())), &plain); err != errMAC || plain.Len() > 0 {
+			t.Errorf("%s: wrong passphrase got %q, %v, want errMAC", name, plain.Bytes(), err)
+		}
+	}
+
+	*kdfFlag = "argon2"
+	if _, err := newKDFParams(); err == nil {
+		t.Errorf("unknown -kdf accepted")
+	}
+	*kdfFlag, *kdfIterFlag = "pbkdf2", 0
+	if _, err := newKDFParams(); err == nil {
+		t.Errorf("-kdf-iter 0 accepted")
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		name = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	good := write("good", "correct horse\r\nnot this\n")
+	empty := write("empty", "\nnot this\n")
+	os.Setenv("WEEK2_TEST_PASS", "battery staple")
+	defer os.Unsetenv("WEEK2_TEST_PASS")
+	os.Unsetenv("WEEK2_TEST_UNSET")
+	defer func(file, env, key, keyFile string) {
+		*passFileFlag, *passEnvFlag, *keyFlag, *keyFileFlag = file, env, key, keyFile
+	}(*passFileFlag, *passEnvFlag, *keyFlag, *keyFileFlag)
+
+	tests := []struct {
+		name                    string
+		file, env, key, keyFile string
+		want                    string
+		err                     string
+	}{
+		{"file", good, "", "", "", "correct horse", ""},
+		{"env", "", "WEEK2_TEST_PASS", "", "", "battery staple", ""},
+		{"file and env", good, "WEEK2_TEST_PASS", "", "", "", "only one of"},
+		{"passphrase and -key", good, "", "000102030405060708090a0b0c0d0e0f", "", "", "passphrase and a key"},
+		{"passphrase and -key-file", "", "WEEK2_TEST_PASS", "", good, "", "passphrase and a key"},
+		{"missing file", filepath.Join(dir, "none"), "", "", "", "", "no such file"},
+		{"unset variable", "", "WEEK2_TEST_UNSET", "", "", "", "not set"},
+		{"empty first line", empty, "", "", "", "", "empty passphrase"},
+	}
+	for _, tt := range tests {
+		*passFileFlag, *passEnvFlag, *keyFlag, *keyFileFlag = tt.file, tt.env, tt.key, tt.keyFile
+
+		got, err := readPassphrase()
+		switch {
+		case tt.err == "" && (err != nil || string(got) != tt.want):
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got %q, %v, want an error with %q", tt.name, got, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package poly1305 implements the Poly1305 one-time authenticator of
+// RFC 8439 section 2.5.
+//
+// A key must authenticate only one message: two tags under the same key
+// give away enough to forge tags for other messages. ChaCha20-Poly1305
+// derives a fresh key from every nonce for this reason.
+package poly1305
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// KeySize is the size of a Poly1305 key, r followed by s.
+	KeySize = 32
+	// TagSize is the size of a Poly1305 tag.
+	TagSize = 16
+
+	blockSize = 16
+	// mask keeps the low 26 bits of a limb.
+	mask = 1<<26 - 1
+)
+
+var ErrKeySize = errors.New("poly1305: key must be 32 bytes")
+
+// MAC computes the Poly1305 tag of everything written to it. The
+// accumulator h and the clamped r are kept in five 26-bit limbs, so the
+// products of two limbs and their sums fit into a uint64.
+type MAC struct {
+	r [5]uint32
+	s [4]uint32
+	h [5]uint32
+	// buf holds the last n bytes written that don't make a whole block.
+	buf [blockSize]byte
+	n   int
+}
+
+// New returns a MAC for a 32-byte one-time key.
+func New(key []byte) (*MAC, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+
+	m := &MAC{}
+	// r is clamped: the top four bits of every 32-bit word and the bottom
+	// two bits of the last three are cleared.
+	m.r[0] = binary.LittleEndian.Uint32(key[0:]) & 0x3ffffff
+	m.r[1] = binary.LittleEndian.Uint32(key[3:]) >> 2 & 0x3ffff03
+	m.r[2] = binary.LittleEndian.Uint32(key[6:]) >> 4 & 0x3ffc0ff
+	m.r[3] = binary.LittleEndian.Uint32(key[9:]) >> 6 & 0x3f03fff
+	m.r[4] = binary.LittleEndian.Uint32(key[12:]) >> 8 & 0x00fffff
+	for k := range m.s {
+		m.s[k] = binary.LittleEndian.Uint32(key[16+4*k:])
+	}
+
+	return m, nil
+}
+
+// Size returns the tag size.
+func (m *MAC) Size() int {
+	return TagSize
+}
+
+// Write adds p to the message. It never returns an error.
+func (m *MAC) Write(p []byte) (int, error) {
+	n := len(p)
+	if m.n > 0 {
+		k := copy(m.buf[m.n:], p)
+		m.n += k
+		p = p[k:]
+		if m.n < blockSize {
+			return n, nil
+		}
+		m.blocks(m.buf[:], 1<<24)
+		m.n = 0
+	}
+
+	whole := len(p) - len(p)%blockSize
+	m.blocks(p[:whole], 1<<24)
+	m.n = copy(m.buf[:], p[whole:])
+
+	return n, nil
+}
+
+// Sum appends the tag of the message written so far to b. It does not
+// change the MAC, so more may be written after it.
+func (m *MAC) Sum(b []byte) []byte {
+	h := *m
+	if h.n > 0 {
+		// the last block gets its 1 byte here instead of as bit 128
+		h.buf[h.n] = 1
+		for k := h.n + 1; k < blockSize; k++ {
+			h.buf[k] = 0
+		}
+		h.blocks(h.buf[:], 0)
+	}
+
+	var tag [TagSize]byte
+	h.finish(&tag)
+	return append(b, tag[:]...)
+}
+
+// Verify reports, in constant time, whether tag is the tag of the message
+// written so far.
+func (m *MAC) Verify(tag []byte) bool {
+	return subtle.ConstantTimeCompare(m.Sum(nil), tag) == 1
+}
+
+// blocks computes h = (h + block + hibit*2^104) * r mod 2^130-5 for every
+// 16-byte block of p. hibit is 1<<24 for whole blocks, whose 2^128 bit
+// sits in the top limb, and 0 for the padded last block.
+func (m *MAC) blocks(p []byte, hibit uint32) {
+	r0, r1, r2, r3, r4 := uint64(m.r[0]), uint64(m.r[1]), uint64(m.r[2]), uint64(m.r[3]), uint64(m.r[4])
+	// 2^130 = 5 mod p, so the limbs that overflow come back in times 5
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+	h0, h1, h2, h3, h4 := m.h[0], m.h[1], m.h[2], m.h[3], m.h[4]
+
+	for ; len(p) >= blockSize; p = p[blockSize:] {
+		h0 += binary.LittleEndian.Uint32(p[0:]) & mask
+		h1 += binary.LittleEndian.Uint32(p[3:]) >> 2 & mask
+		h2 += binary.LittleEndian.Uint32(p[6:]) >> 4 & mask
+		h3 += binary.LittleEndian.Uint32(p[9:]) >> 6 & mask
+		h4 += binary.LittleEndian.Uint32(p[12:])>>8 | hibit
+
+		d0 := uint64(h0)*r0 + uint64(h1)*s4 + uint64(h2)*s3 + uint64(h3)*s2 + uint64(h4)*s1
+		d1 := uint64(h0)*r1 + uint64(h1)*r0 + uint64(h2)*s4 + uint64(h3)*s3 + uint64(h4)*s2
+		d2 := uint64(h0)*r2 + uint64(h1)*r1 + uint64(h2)*r0 + uint64(h3)*s4 + uint64(h4)*s3
+		d3 := uint64(h0)*r3 + uint64(h1)*r2 + uint64(h2)*r1 + uint64(h3)*r0 + uint64(h4)*s4
+		d4 := uint64(h0)*r4 + uint64(h1)*r3 + uint64(h2)*r2 + uint64(h3)*r1 + uint64(h4)*r0
+
+		// carry back down to 26 bits a limb, only partly for h1
+		d1 += d0 >> 26
+		h0 = uint32(d0) & mask
+		d2 += d1 >> 26
+		h1 = uint32(d1) & mask
+		d3 += d2 >> 26
+		h2 = uint32(d2) & mask
+		d4 += d3 >> 26
+		h3 = uint32(d3) & mask
+		c := uint32(d4 >> 26)
+		h4 = uint32(d4) & mask
+		h0 += c * 5
+		c = h0 >> 26
+		h0 &= mask
+		h1 += c
+	}
+
+	m.h = [5]uint32{h0, h1, h2, h3, h4}
+}
+
+// finish reduces h fully mod 2^130-5, adds s and writes the low 128 bits.
+func (m *MAC) finish(tag *[TagSize]byte) {
+	h0, h1, h2, h3, h4 := m.h[0], m.h[1], m.h[2], m.h[3], m.h[4]
+
+	c := h1 >> 26
+	h1 &= mask
+	h2 += c
+	c = h2 >> 26
+	h2 &= mask
+	h3 += c
+	c = h3 >> 26
+	h3 &= mask
+	h4 += c
+	c = h4 >> 26
+	h4 &= mask
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= mask
+	h1 += c
+
+	// g = h + 5 - 2^130, which is h mod p if it doesn't go negative
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= mask
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= mask
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= mask
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= mask
+	g4 := h4 + c - 1<<26
+
+	// pick g if its top bit is clear, without branching on it
+	sel := g4>>31 - 1
+	h0 = h0&^sel | g0&sel
+	h1 = h1&^sel | g1&sel
+	h2 = h2&^sel | g2&sel
+	h3 = h3&^sel | g3&sel
+	h4 = h4&^sel | g4&sel
+
+	// from 26-bit limbs to 32-bit words, mod 2^128
+	w0 := h0 | h1<<26
+	w1 := h1>>6 | h2<<20
+	w2 := h2>>12 | h3<<14
+	w3 := h3>>18 | h4<<8
+
+	f := uint64(w0) + uint64(m.s[0])
+	binary.LittleEndian.PutUint32(tag[0:], uint32(f))
+	f = uint64(w1) + uint64(m.s[1]) + f>>32
+	binary.LittleEndian.PutUint32(tag[4:], uint32(f))
+	f = uint64(w2) + uint64(m.s[2]) + f>>32
+	binary.LittleEndian.PutUint32(tag[8:], uint32(f))
+	f = uint64(w3) + uint64(m.s[3]) + f>>32
+	binary.LittleEndian.PutUint32(tag[12:], uint32(f))
+}
+
+// Sum returns the tag of msg under a one-time key.
+func Sum(msg, key []byte) ([]byte, error) {
+	m, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Write(msg)
+	return m.Sum(nil), nil
+}
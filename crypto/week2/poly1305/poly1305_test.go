@@ -0,0 +1,85 @@
+package poly1305_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/poly1305"
+)
+
+// poly1305Vectors are RFC 8439 section 2.5.2 and the edge cases of
+// appendix A.3, #5 to #9, which make the last carries and the final
+// reduction go wrong if they can.
+var poly1305Vectors = []struct {
+	name string
+	key  string
+	msg  string
+	tag  string
+}{
+	{
+		"2.5.2",
+		"85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b",
+		fmt.Sprintf("%x", "Cryptographic Forum Research Group"),
+		"a8061dc1305136c6c22b8baf0c0127a9",
+	},
+	{
+		"A.3 #5",
+		"0200000000000000000000000000000000000000000000000000000000000000",
+		"ffffffffffffffffffffffffffffffff",
+		"03000000000000000000000000000000",
+	},
+	{
+		"A.3 #6",
+		"02000000000000000000000000000000ffffffffffffffffffffffffffffffff",
+		"02000000000000000000000000000000",
+		"03000000000000000000000000000000",
+	},
+	{
+		"A.3 #7",
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"ffffffffffffffffffffffffffffffff f0ffffffffffffffffffffffffffffff 11000000000000000000000000000000",
+		"05000000000000000000000000000000",
+	},
+	{
+		"A.3 #8",
+		"0100000000000000000000000000000000000000000000000000000000000000",
+		"ffffffffffffffffffffffffffffffff fbfefefefefefefefefefefefefefefe 01010101010101010101010101010101",
+		"00000000000000000000000000000000",
+	},
+	{
+		"A.3 #9",
+		"0200000000000000000000000000000000000000000000000000000000000000",
+		"fdffffffffffffffffffffffffffffff",
+		"faffffffffffffffffffffffffffffff",
+	},
+}
+
+func TestPoly1305Vectors(t *testing.T) {
+	for _, v := range poly1305Vectors {
+		key, msg, want := testutil.Unhex(v.key), testutil.Unhex(v.msg), testutil.Unhex(v.tag)
+
+		got, err := poly1305.Sum(msg, key)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: got %x, want %x", v.name, got, want)
+		}
+
+		// the same message written a byte at a time, with Sum in between
+		m, _ := poly1305.New(key)
+		for k := range msg {
+			m.Sum(nil)
+			m.Write(msg[k : k+1])
+		}
+		if !m.Verify(want) {
+			t.Fatalf("%s: written a byte at a time got %x", v.name, m.Sum(nil))
+		}
+		want[0] ^= 1
+		if m.Verify(want) {
+			t.Fatalf("%s: wrong tag verified", v.name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Command sivdemo shows what reusing a nonce costs under AES-SIV and under
+// CTR mode. The same records are encrypted twice under one key and one
+// nonce: SIV only shows which records are equal, while CTR hands over the
+// XOR of any two records, so knowing one gives away the other.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"log"
+
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var records = []string{
+	"pay alice 100",
+	"pay bob   900",
+	"pay alice 100",
+}
+
+func main() {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Printf("Reading key failed:%s\n", err.Error())
+		return
+	}
+	nonce := make([]byte, aes.BlockSize)
+
+	siv, err := modes.NewAESSIV(key)
+	if err != nil {
+		log.Printf("NewAESSIV failed:%s\n", err.Error())
+		return
+	}
+	fmt.Println("AES-SIV, one nonce for all records:")
+	for _, r := range records {
+		fmt.Printf("  %-14q %x\n", r, siv.Seal(nil, []byte(r), nonce))
+	}
+	fmt.Println("  equal records give equal ciphertexts, that is all that leaks")
+
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		log.Printf("Create aes cipher failed:%s\n", err.Error())
+		return
+	}
+	var cts [][]byte
+	fmt.Println("CTR, one IV for all records:")
+	for _, r := range records {
+		ctr := modes.NewMyCTR(block, nonce)
+		ct := make([]byte, ctr.EncryptedSize(len(r)))
+		if ct, err = ctr.Encrypt(ct, []byte(r)); err != nil {
+			log.Printf("Encrypt failed:%s\n", err.Error())
+			return
+		}
+		cts = append(cts, ct[aes.BlockSize:])
+		fmt.Printf("  %-14q %x\n", r, ct)
+	}
+
+	// c0 ^ c1 = p0 ^ p1, so the first record gives away the second
+	guess := make([]byte, len(cts[1]))
+	for k := range guess {
+		guess[k] = cts[0][k] ^ cts[1][k] ^ records[0][k]
+	}
+	fmt.Printf("  knowing record 0 reveals record 1: %q\n", guess)
+}
@@ -0,0 +1,182 @@
+// Command square breaks 4-round AES-128 with the Square (integral) attack.
+//
+// A Λ-set is 256 plaintexts that take every value in one byte and agree on
+// the other 15. Through three rounds of AES every byte of the state still
+// takes every value once across the set, so the bytes XOR to zero. The
+// fourth round has no MixColumns: each ciphertext byte is only the S-box of
+// one such state byte plus one byte of the last round key. Guessing that key
+// byte and undoing the S-box must give back the zero XOR, which a wrong
+// guess does only one time in 256. A few Λ-sets leave one guess per byte,
+// and the AES-128 key schedule run backwards turns the last round key into
+// the cipher key.
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/lumieru/coursera/crypto/week2/myaes"
+)
+
+const rounds = 4
+
+var (
+	keyFlag     = flag.String("key", "", "AES-128 key in hex to attack, random if empty.")
+	maxSetsFlag = flag.Int("sets", 8, "Largest number of Λ-sets to ask the oracle for.")
+)
+
+// oracle encrypts chosen plaintexts under the secret key and counts them.
+type oracle struct {
+	block   cipher.Block
+	queries int
+}
+
+func (o *oracle) encrypt(pt []byte) []byte {
+	o.queries++
+	ct := make([]byte, myaes.BlockSize)
+	o.block.Encrypt(ct, pt)
+	return ct
+}
+
+// lambdaSet returns the ciphertexts of a Λ-set whose active byte is active
+// and whose other bytes are read from rnd.
+func lambdaSet(o *oracle, rnd io.Reader, active int) ([][]byte, error) {
+	pt := make([]byte, myaes.BlockSize)
+	if _, err := io.ReadFull(rnd, pt); err != nil {
+		return nil, err
+	}
+
+	cts := make([][]byte, 256)
+	for v := range cts {
+		pt[active] = byte(v)
+		cts[v] = o.encrypt(pt)
+	}
+
+	return cts, nil
+}
+
+// filter keeps the guesses for last round key byte pos that turn the
+// ciphertexts of a Λ-set into a balanced byte before the last round.
+func filter(guesses []byte, cts [][]byte, pos int) []byte {
+	kept := guesses[:0]
+	for _, g := range guesses {
+		var sum byte
+		for _, ct := range cts {
+			sum ^= myaes.InvSBox(ct[pos] ^ g)
+		}
+		if sum == 0 {
+			kept = append(kept, g)
+		}
+	}
+
+	return kept
+}
+
+// allGuesses returns every value of a key byte.
+func allGuesses() []byte {
+	guesses := make([]byte, 256)
+	for g := range guesses {
+		guesses[g] = byte(g)
+	}
+
+	return guesses
+}
+
+// attack recovers the last round key of 4-round AES from the oracle,
+// asking it for at most maxSets Λ-sets whose constant bytes come from rnd.
+func attack(o *oracle, rnd io.Reader, maxSets int) ([]byte, error) {
+	var guesses [myaes.BlockSize][]byte
+	for pos := range guesses {
+		guesses[pos] = allGuesses()
+	}
+
+	for set := 0; set < maxSets; set++ {
+		cts, err := lambdaSet(o, rnd, set%myaes.BlockSize)
+		if err != nil {
+			return nil, err
+		}
+
+		left := 0
+		for pos := range guesses {
+			guesses[pos] = filter(guesses[pos], cts, pos)
+			if len(guesses[pos]) == 0 {
+				return nil, fmt.Errorf("no key byte %d is left after %d sets", pos, set+1)
+			}
+			left += len(guesses[pos]) - 1
+		}
+		log.Printf("Λ-set %d: %d wrong guesses left\n", set+1, left)
+
+		if left == 0 {
+			key := make([]byte, myaes.BlockSize)
+			for pos := range key {
+				key[pos] = guesses[pos][0]
+			}
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key bytes still ambiguous after %d sets", maxSets)
+}
+
+// recoverKey runs the attack and turns the last round key it finds into
+// the AES-128 key of the oracle.
+func recoverKey(o *oracle, rnd io.Reader, maxSets int) (lastKey, key []byte, err error) {
+	lastKey, err = attack(o, rnd, maxSets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err = myaes.InvertKeySchedule(lastKey, rounds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return lastKey, key, nil
+}
+
+func main() {
+	flag.Parse()
+
+	key := make([]byte, 16)
+	if *keyFlag != "" {
+		var err error
+		key, err = hex.DecodeString(*keyFlag)
+		if err != nil || len(key) != 16 {
+			log.Printf("Bad -key, want 32 hex digits\n")
+			os.Exit(2)
+		}
+	} else if _, err := rand.Read(key); err != nil {
+		log.Printf("Reading random key failed:%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	block, err := myaes.NewCipherRounds(key, rounds)
+	if err != nil {
+		log.Printf("NewCipherRounds failed:%s\n", err.Error())
+		os.Exit(1)
+	}
+	o := &oracle{block: block}
+
+	lastKey, found, err := recoverKey(o, rand.Reader, *maxSetsFlag)
+	if err != nil {
+		log.Printf("Attack failed:%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("chosen plaintexts: %d\n", o.queries)
+	fmt.Printf("round %d key:      %x\n", rounds, lastKey)
+	fmt.Printf("recovered key:     %x\n", found)
+	fmt.Printf("secret key:        %x\n", key)
+
+	if !bytes.Equal(found, key) {
+		fmt.Println("recovered key is wrong")
+		os.Exit(1)
+	}
+}
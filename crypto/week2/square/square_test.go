@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/myaes"
+)
+
+// squareKey is the AES-128 key of FIPS-197 appendix C.1.
+const squareKey = "000102030405060708090a0b0c0d0e0f"
+
+// newSquareOracle returns an oracle for 4-round AES under squareKey.
+func newSquareOracle(t *testing.T) (*oracle, *myaes.Cipher, []byte) {
+	key, err := hex.DecodeString(squareKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := myaes.NewCipherRounds(key, rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &oracle{block: block}, block, key
+}
+
+// TestRecoverKey breaks the key with two Λ-sets, 512 chosen plaintexts.
+// The seed gives constant bytes for which two sets leave one guess per
+// key byte, as they do for most.
+func TestRecoverKey(t *testing.T) {
+	o, block, key := newSquareOracle(t)
+
+	lastKey, found, err := recoverKey(o, rand.New(rand.NewSource(1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := block.RoundKeys()[rounds]; !bytes.Equal(lastKey, want[:]) {
+		t.Errorf("round %d key got %x, want %x", rounds, lastKey, want)
+	}
+	if !bytes.Equal(found, key) {
+		t.Errorf("recovered key %x, want %x", found, key)
+	}
+	if o.queries != 512 {
+		t.Errorf("used %d chosen plaintexts, want 512", o.queries)
+	}
+}
+
+// TestFilter checks that one Λ-set keeps the right key byte along with a
+// few wrong ones that pass by chance, and that a second set throws them
+// out.
+func TestFilter(t *testing.T) {
+	o, block, _ := newSquareOracle(t)
+	want := block.RoundKeys()[rounds]
+	rnd := rand.New(rand.NewSource(1))
+	first, err := lambdaSet(o, rnd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := lambdaSet(o, rnd, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	falsePositives := 0
+	for pos := range want {
+		guesses := filter(allGuesses(), first, pos)
+		if bytes.IndexByte(guesses, want[pos]) < 0 {
+			t.Fatalf("byte %d: the first set dropped the key byte %02x", pos, want[pos])
+		}
+		falsePositives += len(guesses) - 1
+
+		guesses = filter(guesses, second, pos)
+		if len(guesses) != 1 || guesses[0] != want[pos] {
+			t.Errorf("byte %d: the second set left %x, want %02x", pos, guesses, want[pos])
+		}
+	}
+	if falsePositives == 0 {
+		t.Errorf("the first set left no wrong guesses to filter out")
+	}
+}
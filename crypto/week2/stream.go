@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/lumieru/coursera/crypto/week2/kdf"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+// knownEncoding reports whether -encoding or -key-encoding can be name.
+func knownEncoding(name string) bool {
+	return name == "raw" || name == "hex" || name == "base64"
+}
+
+// spaceDropper drops the white space hex and base64 text may be wrapped
+// in or end with, such as the newline newEncoder adds.
+type spaceDropper struct {
+	r io.Reader
+}
+
+func (s spaceDropper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	k := 0
+	for _, c := range p[:n] {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			p[k] = c
+			k++
+		}
+	}
+
+	return k, err
+}
+
+// newDecoder returns a reader of what r holds in the given encoding.
+func newDecoder(r io.Reader, encoding string) io.Reader {
+	switch encoding {
+	case "hex":
+		return hex.NewDecoder(spaceDropper{r})
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, spaceDropper{r})
+	}
+
+	return r
+}
+
+// lineEncoder is a hex or base64 encoder that ends its output with a
+// newline.
+type lineEncoder struct {
+	io.Writer
+	// enc is the encoder to close first if it buffers a partial group.
+	enc io.Closer
+	w   io.Writer
+}
+
+func (le *lineEncoder) Close() error {
+	if le.enc != nil {
+		if err := le.enc.Close(); err != nil {
+			return err
+		}
+	}
+
+	_, err := le.w.Write([]byte("\n"))
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newEncoder returns a writer that writes to w in the given encoding.
+// Close must be called to finish hex and base64 with a newline; it does
+// not close w.
+func newEncoder(w io.Writer, encoding string) io.WriteCloser {
+	switch encoding {
+	case "hex":
+		return &lineEncoder{Writer: hex.NewEncoder(w), w: w}
+	case "base64":
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		return &lineEncoder{Writer: enc, enc: enc, w: w}
+	}
+
+	return nopWriteCloser{w}
+}
+
+// streamEncrypter returns a writer that encrypts to iv||ciphertext in w
+// for the modes that have one, and nil for the others, which are done in
+// memory.
+func streamEncrypter(mode int, b cipher.Block, iv []byte, w io.Writer) io.WriteCloser {
+	switch mode {
+	case TYPE_CBC:
+		return modes.NewCBCEncryptWriter(w, b, iv)
+	case TYPE_CTR:
+		return modes.NewCTRWriter(w, b, iv)
+	}
+
+	return nil
+}
+
+// streamDecrypter returns a reader of the plaintext of the iv||ciphertext
+// in r for the modes that have one, and nil for the others.
+func streamDecrypter(mode int, b cipher.Block, r io.Reader) io.Reader {
+	switch mode {
+	case TYPE_CBC:
+		return modes.NewCBCDecryptReader(r, b)
+	case TYPE_CTR:
+		return modes.NewCTRReader(r, b)
+	}
+
+	return nil
+}
+
+// encryptBare writes iv||ciphertext of what r holds to w, with a random
+// IV. CBC and CTR stream, the other modes read all of r first.
+func encryptBare(mode int, key []byte, r io.Reader, w io.Writer) error {
+	iv := make([]byte, 16)
+	if _, err := rand.Read(iv); err != nil {
+		return err
+	}
+	b, err := newModeCipher(mode, key)
+	if err != nil {
+		return err
+	}
+
+	if sw := streamEncrypter(mode, b, iv, w); sw != nil {
+		if _, err := io.Copy(sw, r); err != nil {
+			return err
+		}
+		return sw.Close()
+	}
+
+	msg, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dst, err := encryptMode(mode, key, iv, msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dst)
+	return err
+}
+
+// decryptBare decrypts what encryptBare wrote.
+func decryptBare(mode int, key []byte, r io.Reader, w io.Writer) error {
+	b, err := newModeCipher(mode, key)
+	if err != nil {
+		return err
+	}
+
+	if sr := streamDecrypter(mode, b, r); sr != nil {
+		_, err := io.Copy(w, sr)
+		return err
+	}
+
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dst, err := decryptMode(mode, key, make([]byte, 16), src)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(dst)
+	return err
+}
+
+// encrypt encrypts what r holds to w in the -format.
+func encrypt(mode int, key, passphrase []byte, params *kdf.Params, r io.Reader, w io.Writer) error {
+	switch *formatFlag {
+	case "openssl":
+		msg, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		dst, err := encryptOpenSSL(passphrase, msg)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(dst)
+		return err
+	case "container":
+		return encryptContainer(mode, key, passphrase, params, r, w)
+	}
+
+	return encryptBare(mode, key, r, w)
+}
+
+// decrypt decrypts what r holds to w in the -format, or as a container if
+// it is one.
+func decrypt(mode int, key, passphrase []byte, r io.Reader, w io.Writer) error {
+	if *formatFlag == "openssl" {
+		src, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		dst, err := decryptOpenSSL(passphrase, src)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(dst)
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	if isContainer(br) || passphrase != nil {
+		return decryptContainer(key, passphrase, br, w)
+	}
+
+	return decryptBare(mode, key, br, w)
+}
+
+func openInput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(name)
+}
+
+// createOutput creates the output file, refusing the input file, which
+// would be truncated before it is read.
+func createOutput(name string, in *os.File) (*os.File, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+
+	if fi, err := os.Stat(name); err == nil {
+		if inFi, err := in.Stat(); err == nil && os.SameFile(fi, inFi) {
+			return nil, errors.New("input and output are the same file")
+		}
+	}
+
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
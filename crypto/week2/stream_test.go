@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lumieru/coursera/crypto/week2/internal/testutil"
+	"github.com/lumieru/coursera/crypto/week2/modes"
+)
+
+var testKey = testutil.Unhex("000102030405060708090a0b0c0d0e0f")
+
+func TestBareRoundTrip(t *testing.T) {
+	for _, mode := range []int{TYPE_CBC, TYPE_CTR, TYPE_ECB, TYPE_OFB} {
+		for _, size := range []int{0, 1, 16, 17, 100000} {
+			msg := bytes.Repeat([]byte{'b'}, size)
+			var wire, plain bytes.Buffer
+			if err := encryptBare(mode, testKey, bytes.NewReader(msg), &wire); err != nil {
+				t.Fatalf("mode %d, %d bytes: encrypt failed with: %v", mode, size, err)
+			}
+			// encryptMode with the IV encryptBare picked must agree
+			want, err := encryptMode(mode, testKey, wire.Bytes()[:16], msg)
+			if err != nil || !bytes.Equal(wire.Bytes(), want) {
+				t.Fatalf("mode %d, %d bytes: stream differs from encryptMode", mode, size)
+			}
+			if err := decryptBare(mode, testKey, bytes.NewReader(wire.Bytes()), &plain); err != nil || !bytes.Equal(plain.Bytes(), msg) {
+				t.Fatalf("mode %d, %d bytes: read back %d bytes, %v", mode, size, plain.Len(), err)
+			}
+		}
+	}
+}
+
+// TestBareCTROverflow decrypts a CTR body longer than what is left of the
+// counter in its IV, which must fail rather than reuse key stream.
+func TestBareCTROverflow(t *testing.T) {
+	src := append(testutil.Unhex("0000000000000000ffffffffffffffff"), make([]byte, 17)...)
+	if err := decryptBare(TYPE_CTR, testKey, bytes.NewReader(src), ioutil.Discard); err != modes.ErrCounterOverflow {
+		t.Errorf("got %v, want ErrCounterOverflow", err)
+	}
+
+	// the one block that is left is fine
+	if err := decryptBare(TYPE_CTR, testKey, bytes.NewReader(src[:32]), ioutil.Discard); err != nil {
+		t.Errorf("last block: got %v", err)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	msg := []byte("any carnal pleasure.")
+	for _, encoding := range []string{"raw", "hex", "base64"} {
+		var buf bytes.Buffer
+		enc := newEncoder(&buf, encoding)
+		for k := range msg {
+			enc.Write(msg[k : k+1])
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// wrapped text decodes as well
+		wrapped := bytes.Replace(buf.Bytes(), []byte("a"), []byte("a\r\n "), -1)
+		if encoding == "raw" {
+			wrapped = buf.Bytes()
+		}
+		got, err := ioutil.ReadAll(newDecoder(bytes.NewReader(wrapped), encoding))
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("%s: got %q, %v, want %q", encoding, got, err, msg)
+		}
+	}
+}
+
+func TestCreateOutputRefusesInput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "msg")
+	if err := ioutil.WriteFile(name, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	in, err := openInput(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	if out, err := createOutput(name, in); err == nil {
+		out.Close()
+		t.Errorf("the input file was opened as output")
+	}
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "keep me" {
+		t.Errorf("the input file now holds %q, %v", data, err)
+	}
+
+	out, err := createOutput(filepath.Join(filepath.Dir(name), "out"), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if fi, err := out.Stat(); err != nil || fi.Mode().Perm() != os.FileMode(0600) {
+		t.Errorf("output mode %v, %v, want 0600", fi.Mode(), err)
+	}
+}